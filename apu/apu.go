@@ -0,0 +1,345 @@
+package apu
+
+import (
+	"tgb/memory"
+	"tgb/timer"
+)
+
+const (
+	// Sound Channel 1 - Tone & Sweep
+	NR10 = 0xFF10 // Sweep register (R/W)
+	NR11 = 0xFF11 // Sound length/Wave pattern duty (R/W)
+	NR12 = 0xFF12 // Volume Envelope (R/W)
+	NR13 = 0xFF13 // Frequency lo (W)
+	NR14 = 0xFF14 // Frequency hi (R/W)
+
+	// Sound Channel 2 - Tone
+	NR21 = 0xFF16
+	NR22 = 0xFF17
+	NR23 = 0xFF18
+	NR24 = 0xFF19
+
+	// Sound Channel 3 - Wave Output
+	NR30 = 0xFF1A // Sound on/off (R/W)
+	NR31 = 0xFF1B // Sound Length
+	NR32 = 0xFF1C // Select output level (R/W)
+	NR33 = 0xFF1D // Frequency's lower data (W)
+	NR34 = 0xFF1E // Frequency's higher data (R/W)
+
+	// Sound Channel 4 - Noise
+	NR41 = 0xFF20 // Sound Length (R/W)
+	NR42 = 0xFF21 // Volume Envelope (R/W)
+	NR43 = 0xFF22 // Polynomial Counter (R/W)
+	NR44 = 0xFF23 // Counter/consecutive; Inital (R/W)
+
+	// Sound Control Registers
+	// NR50 - Channel control / ON-OFF / Volume (R/W)
+	//  Bit 7   - Output Vin to SO2 terminal (1=Enable)
+	//  Bit 6-4 - SO2 output level (volume)  (0-7)
+	//  Bit 3   - Output Vin to SO1 terminal (1=Enable)
+	//  Bit 2-0 - SO1 output level (volume)  (0-7)
+	NR50 = 0xFF24
+	// NR51 - Selection of Sound output terminal (R/W)
+	//  Bit 7-4 - Output sound 4-1 to SO2 terminal (left)
+	//  Bit 3-0 - Output sound 4-1 to SO1 terminal (right)
+	NR51 = 0xFF25
+	// NR52 - Sound on/off
+	//  Bit 7   - All sound on/off  (0: stop all sound circuits) (Read/Write)
+	//  Bit 3-0 - Sound 4-1 ON flag (Read Only)
+	NR52 = 0xFF26
+
+	// FF30-FF3F - Wave Pattern RAM
+	// Contents - Waveform storage for arbitrary sound data
+	// This storage area holds 32 4-bits samples that are played back, upper 4 bits first.
+	WAVE_RAM = 0xFF30
+
+	// The frame sequencer is clocked at 512Hz.
+	CYCLES_FRAME_SEQUENCER = timer.CLOCK_CYCLE / 512
+
+	DEFAULT_SAMPLE_RATE = 44100
+)
+
+// Bits which always read back as 1, indexed from NR10.
+var readMask = [0x20]uint8{
+	0x80, 0x3F, 0x00, 0xFF, 0xBF, // NR10-NR14
+	0xFF, 0x3F, 0x00, 0xFF, 0xBF, // NR20-NR24
+	0x7F, 0xFF, 0x9F, 0xFF, 0xBF, // NR30-NR34
+	0xFF, 0xFF, 0x00, 0x00, 0xBF, // NR40-NR44
+	0x00, 0x00, 0x70, // NR50-NR52
+	0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF,
+}
+
+type APU struct {
+	ch1 *square
+	ch2 *square
+	ch3 *wave
+	ch4 *noise
+
+	// FF10-FF3F as written by the game
+	regs [0x30]uint8
+
+	enabled bool
+
+	frameSequencer int
+	fsCycle        int
+
+	// Output samples per second. Must be set before the first Update.
+	SampleRate int
+
+	// sampleCycle counts clocks multiplied by SampleRate so that one
+	// sample is emitted every CLOCK_CYCLE / SampleRate clocks exactly.
+	sampleCycle int
+
+	// interleaved stereo samples (left, right, left, ...)
+	samples []int16
+}
+
+func New(mem *memory.Memory, sampleRate int) *APU {
+	apu := &APU{
+		ch1:        newSquare(true),
+		ch2:        newSquare(false),
+		ch3:        newWave(),
+		ch4:        newNoise(),
+		enabled:    true,
+		SampleRate: sampleRate,
+	}
+
+	for addr := uint16(NR10); addr <= 0xFF3F; addr++ {
+		a := addr
+		mem.HandleRead(a, func() uint8 { return apu.read(a) })
+		mem.HandleWrite(a, func(val uint8) { apu.write(a, val) })
+	}
+	return apu
+}
+
+// Update advances the APU by cycles clocks (4.194304MHz) and
+// collects the samples produced in the meantime.
+func (apu *APU) Update(cycles int) {
+	for cycles > 0 {
+		// clocks until the next output sample is due
+		n := (timer.CLOCK_CYCLE - apu.sampleCycle + apu.SampleRate - 1) / apu.SampleRate
+		if n > cycles {
+			n = cycles
+		}
+		if n < 1 {
+			n = 1
+		}
+		apu.step(n)
+		cycles -= n
+
+		apu.sampleCycle += n * apu.SampleRate
+		if apu.sampleCycle >= timer.CLOCK_CYCLE {
+			apu.sampleCycle -= timer.CLOCK_CYCLE
+			left, right := apu.mix()
+			apu.samples = append(apu.samples, left, right)
+		}
+	}
+}
+
+// Flush returns the samples produced since the last call.
+func (apu *APU) Flush() []int16 {
+	s := apu.samples
+	apu.samples = nil
+	return s
+}
+
+func (apu *APU) step(cycles int) {
+	if !apu.enabled {
+		return
+	}
+
+	apu.fsCycle += cycles
+	for apu.fsCycle >= CYCLES_FRAME_SEQUENCER {
+		apu.fsCycle -= CYCLES_FRAME_SEQUENCER
+		apu.clockFrameSequencer()
+	}
+
+	apu.ch1.step(cycles)
+	apu.ch2.step(cycles)
+	apu.ch3.step(cycles)
+	apu.ch4.step(cycles)
+}
+
+// Step   Length Ctr  Vol Env     Sweep
+// ---------------------------------------
+// 0      Clock       -           -
+// 1      -           -           -
+// 2      Clock       -           Clock
+// 3      -           -           -
+// 4      Clock       -           -
+// 5      -           -           -
+// 6      Clock       -           Clock
+// 7      -           Clock       -
+func (apu *APU) clockFrameSequencer() {
+	switch apu.frameSequencer {
+	case 0, 4:
+		apu.clockLength()
+	case 2, 6:
+		apu.clockLength()
+		apu.ch1.clockSweep()
+	case 7:
+		apu.ch1.env.clock()
+		apu.ch2.env.clock()
+		apu.ch4.env.clock()
+	}
+	apu.frameSequencer = (apu.frameSequencer + 1) % 8
+}
+
+func (apu *APU) clockLength() {
+	apu.ch1.length.clock(&apu.ch1.on)
+	apu.ch2.length.clock(&apu.ch2.on)
+	apu.ch3.length.clock(&apu.ch3.on)
+	apu.ch4.length.clock(&apu.ch4.on)
+}
+
+// mix applies NR51 panning and NR50 master volume to the four DAC outputs.
+func (apu *APU) mix() (int16, int16) {
+	if !apu.enabled {
+		return 0, 0
+	}
+
+	outputs := [4]float64{
+		dac(apu.ch1.dac, apu.ch1.output()),
+		dac(apu.ch2.dac, apu.ch2.output()),
+		dac(apu.ch3.dac, apu.ch3.output()),
+		dac(apu.ch4.dac, apu.ch4.output()),
+	}
+
+	nr50 := apu.reg(NR50)
+	nr51 := apu.reg(NR51)
+
+	var left, right float64
+	for i, out := range outputs {
+		if nr51&(0x10<<uint(i)) != 0 {
+			left += out
+		}
+		if nr51&(0x01<<uint(i)) != 0 {
+			right += out
+		}
+	}
+	left *= float64((nr50>>4)&0x07+1) / 8
+	right *= float64(nr50&0x07+1) / 8
+
+	return toSample(left / 4), toSample(right / 4)
+}
+
+// dac converts a 4bit digital value to -1.0 - 1.0.
+// A disabled DAC outputs silence.
+func dac(enabled bool, digital uint8) float64 {
+	if !enabled {
+		return 0
+	}
+	return float64(digital)/7.5 - 1
+}
+
+func toSample(v float64) int16 {
+	return int16(v * 32767)
+}
+
+func (apu *APU) reg(addr uint16) uint8 {
+	return apu.regs[addr-NR10]
+}
+
+func (apu *APU) read(addr uint16) uint8 {
+	if addr >= WAVE_RAM {
+		return apu.reg(addr)
+	}
+
+	val := apu.reg(addr) | readMask[addr-NR10]
+	if addr == NR52 {
+		val &= 0x70
+		if apu.enabled {
+			val |= 0x80
+		}
+		for i, on := range []bool{apu.ch1.on, apu.ch2.on, apu.ch3.on, apu.ch4.on} {
+			if on {
+				val |= 1 << uint(i)
+			}
+		}
+	}
+	return val
+}
+
+func (apu *APU) write(addr uint16, val uint8) {
+	if addr >= WAVE_RAM {
+		apu.regs[addr-NR10] = val
+		apu.ch3.ram[addr-WAVE_RAM] = val
+		return
+	}
+
+	// While all sound is off, only NR52 is writable.
+	if !apu.enabled && addr != NR52 {
+		return
+	}
+	apu.regs[addr-NR10] = val
+
+	switch addr {
+	case NR10:
+		apu.ch1.writeSweep(val)
+	case NR11:
+		apu.ch1.writeDutyLength(val)
+	case NR12:
+		apu.ch1.writeEnvelope(val)
+	case NR13:
+		apu.ch1.freq = apu.ch1.freq&0x700 | uint16(val)
+	case NR14:
+		apu.ch1.writeControl(val)
+
+	case NR21:
+		apu.ch2.writeDutyLength(val)
+	case NR22:
+		apu.ch2.writeEnvelope(val)
+	case NR23:
+		apu.ch2.freq = apu.ch2.freq&0x700 | uint16(val)
+	case NR24:
+		apu.ch2.writeControl(val)
+
+	case NR30:
+		apu.ch3.dac = val&0x80 != 0
+		if !apu.ch3.dac {
+			apu.ch3.on = false
+		}
+	case NR31:
+		apu.ch3.length.load(256 - int(val))
+	case NR32:
+		apu.ch3.volumeCode = (val >> 5) & 0x03
+	case NR33:
+		apu.ch3.freq = apu.ch3.freq&0x700 | uint16(val)
+	case NR34:
+		apu.ch3.writeControl(val)
+
+	case NR41:
+		apu.ch4.length.load(64 - int(val&0x3F))
+	case NR42:
+		apu.ch4.writeEnvelope(val)
+	case NR43:
+		apu.ch4.writePolynomial(val)
+	case NR44:
+		apu.ch4.writeControl(val)
+
+	case NR52:
+		apu.setPower(val&0x80 != 0)
+	}
+}
+
+// Turning the APU off clears every sound register and stops all channels.
+func (apu *APU) setPower(on bool) {
+	if on == apu.enabled {
+		return
+	}
+	apu.enabled = on
+	if on {
+		apu.frameSequencer = 0
+		return
+	}
+
+	ram := apu.ch3.ram
+	for addr := uint16(NR10); addr < NR52; addr++ {
+		apu.regs[addr-NR10] = 0
+	}
+	apu.ch1 = newSquare(true)
+	apu.ch2 = newSquare(false)
+	apu.ch3 = newWave()
+	apu.ch3.ram = ram
+	apu.ch4 = newNoise()
+}
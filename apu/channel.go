@@ -0,0 +1,81 @@
+package apu
+
+// lengthCounter turns its channel off when it reaches zero.
+// It is clocked at 256Hz by the frame sequencer.
+type lengthCounter struct {
+	enabled bool
+	value   int
+	max     int
+}
+
+func (l *lengthCounter) load(value int) {
+	l.value = value
+}
+
+// On trigger an expired counter is reloaded with its maximum.
+func (l *lengthCounter) trigger() {
+	if l.value == 0 {
+		l.value = l.max
+	}
+}
+
+func (l *lengthCounter) clock(on *bool) {
+	if !l.enabled || l.value == 0 {
+		return
+	}
+	l.value--
+	if l.value == 0 {
+		*on = false
+	}
+}
+
+// NRx2 - Volume Envelope (R/W)
+//
+//	Bit 7-4 - Initial Volume of envelope (0-0Fh) (0=No Sound)
+//	Bit 3   - Envelope Direction (0=Decrease, 1=Increase)
+//	Bit 2-0 - Number of envelope sweep (n: 0-7)
+//	          (If zero, stop envelope operation.)
+type envelope struct {
+	initial  uint8
+	increase bool
+	period   uint8
+
+	volume uint8
+	timer  uint8
+}
+
+func (e *envelope) write(val uint8) {
+	e.initial = val >> 4
+	e.increase = val&0x08 != 0
+	e.period = val & 0x07
+}
+
+func (e *envelope) trigger() {
+	e.volume = e.initial
+	e.timer = e.period
+}
+
+// clocked at 64Hz by the frame sequencer
+func (e *envelope) clock() {
+	if e.period == 0 {
+		return
+	}
+	if e.timer > 0 {
+		e.timer--
+	}
+	if e.timer != 0 {
+		return
+	}
+	e.timer = e.period
+
+	if e.increase && e.volume < 0x0F {
+		e.volume++
+	} else if !e.increase && e.volume > 0 {
+		e.volume--
+	}
+}
+
+// The DAC of channel 1, 2 and 4 is on while the upper 5 bits of NRx2 aren't all 0.
+func dacEnabled(nrx2 uint8) bool {
+	return nrx2&0xF8 != 0
+}
@@ -0,0 +1,87 @@
+package apu
+
+var noiseDivisors = [8]int{8, 16, 32, 48, 64, 80, 96, 112}
+
+// noise is channel 4, a 15bit (or 7bit) linear feedback shift register.
+type noise struct {
+	on  bool
+	dac bool
+
+	// NR43 - Polynomial Counter (R/W)
+	//  Bit 7-4 - Shift Clock Frequency (s)
+	//  Bit 3   - Counter Step/Width (0=15 bits, 1=7 bits)
+	//  Bit 2-0 - Dividing Ratio of Frequencies (r)
+	shift   uint8
+	width7  bool
+	divisor uint8
+
+	lfsr  uint16
+	timer int
+
+	length lengthCounter
+	env    envelope
+}
+
+func newNoise() *noise {
+	return &noise{
+		length: lengthCounter{max: 64},
+		lfsr:   0x7FFF,
+	}
+}
+
+func (n *noise) step(cycles int) {
+	n.timer -= cycles
+	for n.timer <= 0 {
+		n.timer += n.period()
+
+		xor := (n.lfsr & 0x01) ^ ((n.lfsr >> 1) & 0x01)
+		n.lfsr = (n.lfsr >> 1) | xor<<14
+		if n.width7 {
+			n.lfsr = n.lfsr&^0x40 | xor<<6
+		}
+	}
+}
+
+func (n *noise) period() int {
+	return noiseDivisors[n.divisor] << n.shift
+}
+
+func (n *noise) output() uint8 {
+	if !n.on || !n.dac {
+		return 0
+	}
+	// the output is the inverted bit 0
+	if n.lfsr&0x01 != 0 {
+		return 0
+	}
+	return n.env.volume
+}
+
+func (n *noise) writeEnvelope(val uint8) {
+	n.env.write(val)
+	n.dac = dacEnabled(val)
+	if !n.dac {
+		n.on = false
+	}
+}
+
+func (n *noise) writePolynomial(val uint8) {
+	n.shift = val >> 4
+	n.width7 = val&0x08 != 0
+	n.divisor = val & 0x07
+}
+
+func (n *noise) writeControl(val uint8) {
+	n.length.enabled = val&0x40 != 0
+	if val&0x80 != 0 {
+		n.trigger()
+	}
+}
+
+func (n *noise) trigger() {
+	n.on = n.dac
+	n.timer = n.period()
+	n.lfsr = 0x7FFF
+	n.length.trigger()
+	n.env.trigger()
+}
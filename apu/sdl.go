@@ -0,0 +1,76 @@
+package apu
+
+import (
+	"encoding/binary"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// SDLSink plays samples through the default SDL audio device.
+type SDLSink struct {
+	device sdl.AudioDeviceID
+	ring   *ringBuffer
+
+	// Sync waits while more than latency bytes are queued in SDL.
+	latency uint32
+
+	samples []int16
+	bytes   []byte
+}
+
+func NewSDLSink(sampleRate int) (*SDLSink, error) {
+	if err := sdl.InitSubSystem(sdl.INIT_AUDIO); err != nil {
+		return nil, err
+	}
+
+	spec := &sdl.AudioSpec{
+		Freq:     int32(sampleRate),
+		Format:   sdl.AUDIO_S16LSB,
+		Channels: 2,
+		Samples:  1024,
+	}
+	device, err := sdl.OpenAudioDevice("", false, spec, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	sdl.PauseAudioDevice(device, false)
+
+	// about 1/15 second of stereo 16bit samples, 4 frames
+	frameSamples := sampleRate / 15 * 2
+	return &SDLSink{
+		device:  device,
+		ring:    newRingBuffer(frameSamples * 4),
+		latency: uint32(frameSamples * 2),
+	}, nil
+}
+
+func (s *SDLSink) Write(samples []int16) error {
+	s.ring.write(samples)
+	return nil
+}
+
+// Sync hands the buffered samples to SDL and waits for the device
+// to catch up with the emulator.
+func (s *SDLSink) Sync() {
+	if n := s.ring.len(); n > 0 {
+		if cap(s.samples) < n {
+			s.samples = make([]int16, n)
+			s.bytes = make([]byte, n*2)
+		}
+		samples := s.samples[:s.ring.read(s.samples[:n])]
+		bytes := s.bytes[:len(samples)*2]
+		for i, v := range samples {
+			binary.LittleEndian.PutUint16(bytes[i*2:], uint16(v))
+		}
+		sdl.QueueAudio(s.device, bytes)
+	}
+
+	for sdl.GetQueuedAudioSize(s.device) > s.latency {
+		sdl.Delay(1)
+	}
+}
+
+func (s *SDLSink) Close() error {
+	sdl.CloseAudioDevice(s.device)
+	return nil
+}
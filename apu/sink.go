@@ -0,0 +1,55 @@
+package apu
+
+// AudioSink consumes the interleaved stereo samples produced by the APU.
+type AudioSink interface {
+	Write(samples []int16) error
+	Close() error
+}
+
+// Pacer is implemented by sinks that play in real time.
+// Sync is called once per frame and blocks until the device has
+// consumed enough audio, so the sound card sets the emulation speed.
+type Pacer interface {
+	Sync()
+}
+
+// ringBuffer holds samples between the emulator and the audio device.
+// When it is full the oldest samples are dropped.
+type ringBuffer struct {
+	data  []int16
+	start int
+	size  int
+}
+
+func newRingBuffer(capacity int) *ringBuffer {
+	return &ringBuffer{
+		data: make([]int16, capacity),
+	}
+}
+
+func (r *ringBuffer) write(samples []int16) {
+	for _, s := range samples {
+		end := (r.start + r.size) % len(r.data)
+		r.data[end] = s
+		if r.size < len(r.data) {
+			r.size++
+		} else {
+			r.start = (r.start + 1) % len(r.data)
+		}
+	}
+}
+
+// read moves up to len(dst) samples into dst.
+func (r *ringBuffer) read(dst []int16) int {
+	n := 0
+	for ; n < len(dst) && r.size > 0; n++ {
+		dst[n] = r.data[r.start]
+		r.start = (r.start + 1) % len(r.data)
+		r.size--
+	}
+	return n
+}
+
+func (r *ringBuffer) len() int {
+	return r.size
+}
@@ -0,0 +1,163 @@
+package apu
+
+// NRx1 Bit 7-6 - Wave Pattern Duty
+//
+//	00: 12.5% ( _-------_-------_------- )
+//	01: 25%   ( __------__------__------ )
+//	10: 50%   ( ____----____----____---- )
+//	11: 75%   ( ______--______--______-- )
+var dutyTable = [4][8]uint8{
+	{0, 0, 0, 0, 0, 0, 0, 1},
+	{1, 0, 0, 0, 0, 0, 0, 1},
+	{1, 0, 0, 0, 0, 1, 1, 1},
+	{0, 1, 1, 1, 1, 1, 1, 0},
+}
+
+// square is channel 1 (with sweep) or channel 2.
+type square struct {
+	on  bool
+	dac bool
+
+	duty    uint8
+	dutyPos uint8
+
+	// 11bit frequency, the timer period is (2048-freq)*4 clocks
+	freq  uint16
+	timer int
+
+	length lengthCounter
+	env    envelope
+
+	// NR10 - Channel 1 Sweep register (R/W)
+	//  Bit 6-4 - Sweep Time
+	//  Bit 3   - Sweep Increase/Decrease (0: Addition, 1: Subtraction)
+	//  Bit 2-0 - Number of sweep shift (n: 0-7)
+	hasSweep     bool
+	sweepPeriod  uint8
+	sweepNegate  bool
+	sweepShift   uint8
+	sweepTimer   uint8
+	sweepEnabled bool
+	shadowFreq   uint16
+}
+
+func newSquare(hasSweep bool) *square {
+	return &square{
+		hasSweep: hasSweep,
+		length:   lengthCounter{max: 64},
+	}
+}
+
+func (s *square) step(cycles int) {
+	s.timer -= cycles
+	for s.timer <= 0 {
+		s.timer += s.period()
+		s.dutyPos = (s.dutyPos + 1) % 8
+	}
+}
+
+func (s *square) period() int {
+	return (2048 - int(s.freq)) * 4
+}
+
+func (s *square) output() uint8 {
+	if !s.on || !s.dac {
+		return 0
+	}
+	return dutyTable[s.duty][s.dutyPos] * s.env.volume
+}
+
+func (s *square) writeSweep(val uint8) {
+	s.sweepPeriod = (val >> 4) & 0x07
+	s.sweepNegate = val&0x08 != 0
+	s.sweepShift = val & 0x07
+}
+
+func (s *square) writeDutyLength(val uint8) {
+	s.duty = val >> 6
+	s.length.load(64 - int(val&0x3F))
+}
+
+func (s *square) writeEnvelope(val uint8) {
+	s.env.write(val)
+	s.dac = dacEnabled(val)
+	if !s.dac {
+		s.on = false
+	}
+}
+
+// NRx4
+//
+//	Bit 7   - Initial (1=Restart Sound)
+//	Bit 6   - Counter/consecutive selection
+//	Bit 2-0 - Frequency's higher 3 bits (x)
+func (s *square) writeControl(val uint8) {
+	s.freq = s.freq&0xFF | uint16(val&0x07)<<8
+	s.length.enabled = val&0x40 != 0
+	if val&0x80 != 0 {
+		s.trigger()
+	}
+}
+
+func (s *square) trigger() {
+	s.on = s.dac
+	s.timer = s.period()
+	s.length.trigger()
+	s.env.trigger()
+
+	if !s.hasSweep {
+		return
+	}
+	s.shadowFreq = s.freq
+	s.reloadSweepTimer()
+	s.sweepEnabled = s.sweepPeriod != 0 || s.sweepShift != 0
+	if s.sweepShift != 0 {
+		s.calcSweep()
+	}
+}
+
+func (s *square) reloadSweepTimer() {
+	s.sweepTimer = s.sweepPeriod
+	if s.sweepTimer == 0 {
+		s.sweepTimer = 8
+	}
+}
+
+// clocked at 128Hz by the frame sequencer
+func (s *square) clockSweep() {
+	if !s.hasSweep {
+		return
+	}
+	if s.sweepTimer > 0 {
+		s.sweepTimer--
+	}
+	if s.sweepTimer != 0 {
+		return
+	}
+	s.reloadSweepTimer()
+
+	if !s.sweepEnabled || s.sweepPeriod == 0 {
+		return
+	}
+	freq := s.calcSweep()
+	if freq <= 2047 && s.sweepShift != 0 {
+		s.shadowFreq = freq
+		s.freq = freq
+		s.calcSweep()
+	}
+}
+
+// calcSweep returns the next frequency and disables the channel on overflow.
+func (s *square) calcSweep() uint16 {
+	delta := s.shadowFreq >> s.sweepShift
+	var freq uint16
+	if s.sweepNegate {
+		freq = s.shadowFreq - delta
+	} else {
+		freq = s.shadowFreq + delta
+	}
+	if freq > 2047 {
+		s.on = false
+	}
+	return freq
+}
@@ -0,0 +1,211 @@
+package apu
+
+// State is what a save state keeps of the APU. The samples not
+// flushed yet are dropped.
+type State struct {
+	Regs           [0x30]uint8
+	Enabled        bool
+	FrameSequencer int64
+	FSCycle        int64
+	SampleCycle    int64
+
+	Ch1, Ch2 SquareState
+	Ch3      WaveState
+	Ch4      NoiseState
+}
+
+type LengthState struct {
+	Enabled bool
+	Value   int64
+}
+
+type EnvelopeState struct {
+	Initial  uint8
+	Increase bool
+	Period   uint8
+	Volume   uint8
+	Timer    uint8
+}
+
+type SquareState struct {
+	On, DAC bool
+	Duty    uint8
+	DutyPos uint8
+	Freq    uint16
+	Timer   int64
+	Length  LengthState
+	Env     EnvelopeState
+
+	SweepPeriod  uint8
+	SweepNegate  bool
+	SweepShift   uint8
+	SweepTimer   uint8
+	SweepEnabled bool
+	ShadowFreq   uint16
+}
+
+type WaveState struct {
+	On, DAC    bool
+	Freq       uint16
+	Timer      int64
+	Pos        uint8
+	Sample     uint8
+	VolumeCode uint8
+	Length     LengthState
+	RAM        [16]uint8
+}
+
+type NoiseState struct {
+	On, DAC bool
+	Shift   uint8
+	Width7  bool
+	Divisor uint8
+	LFSR    uint16
+	Timer   int64
+	Length  LengthState
+	Env     EnvelopeState
+}
+
+func (apu *APU) State() *State {
+	return &State{
+		Regs:           apu.regs,
+		Enabled:        apu.enabled,
+		FrameSequencer: int64(apu.frameSequencer),
+		FSCycle:        int64(apu.fsCycle),
+		SampleCycle:    int64(apu.sampleCycle),
+		Ch1:            apu.ch1.state(),
+		Ch2:            apu.ch2.state(),
+		Ch3:            apu.ch3.state(),
+		Ch4:            apu.ch4.state(),
+	}
+}
+
+func (apu *APU) SetState(s *State) {
+	apu.regs = s.Regs
+	apu.enabled = s.Enabled
+	apu.frameSequencer = int(s.FrameSequencer)
+	apu.fsCycle = int(s.FSCycle)
+	apu.sampleCycle = int(s.SampleCycle)
+	apu.ch1.setState(s.Ch1)
+	apu.ch2.setState(s.Ch2)
+	apu.ch3.setState(s.Ch3)
+	apu.ch4.setState(s.Ch4)
+	apu.samples = apu.samples[:0]
+}
+
+func (l *lengthCounter) state() LengthState {
+	return LengthState{Enabled: l.enabled, Value: int64(l.value)}
+}
+
+func (l *lengthCounter) setState(s LengthState) {
+	l.enabled = s.Enabled
+	l.value = int(s.Value)
+}
+
+func (e *envelope) state() EnvelopeState {
+	return EnvelopeState{
+		Initial:  e.initial,
+		Increase: e.increase,
+		Period:   e.period,
+		Volume:   e.volume,
+		Timer:    e.timer,
+	}
+}
+
+func (e *envelope) setState(s EnvelopeState) {
+	*e = envelope{
+		initial:  s.Initial,
+		increase: s.Increase,
+		period:   s.Period,
+		volume:   s.Volume,
+		timer:    s.Timer,
+	}
+}
+
+func (s *square) state() SquareState {
+	return SquareState{
+		On:           s.on,
+		DAC:          s.dac,
+		Duty:         s.duty,
+		DutyPos:      s.dutyPos,
+		Freq:         s.freq,
+		Timer:        int64(s.timer),
+		Length:       s.length.state(),
+		Env:          s.env.state(),
+		SweepPeriod:  s.sweepPeriod,
+		SweepNegate:  s.sweepNegate,
+		SweepShift:   s.sweepShift,
+		SweepTimer:   s.sweepTimer,
+		SweepEnabled: s.sweepEnabled,
+		ShadowFreq:   s.shadowFreq,
+	}
+}
+
+func (s *square) setState(st SquareState) {
+	s.on = st.On
+	s.dac = st.DAC
+	s.duty = st.Duty
+	s.dutyPos = st.DutyPos
+	s.freq = st.Freq
+	s.timer = int(st.Timer)
+	s.length.setState(st.Length)
+	s.env.setState(st.Env)
+	s.sweepPeriod = st.SweepPeriod
+	s.sweepNegate = st.SweepNegate
+	s.sweepShift = st.SweepShift
+	s.sweepTimer = st.SweepTimer
+	s.sweepEnabled = st.SweepEnabled
+	s.shadowFreq = st.ShadowFreq
+}
+
+func (w *wave) state() WaveState {
+	return WaveState{
+		On:         w.on,
+		DAC:        w.dac,
+		Freq:       w.freq,
+		Timer:      int64(w.timer),
+		Pos:        w.pos,
+		Sample:     w.sample,
+		VolumeCode: w.volumeCode,
+		Length:     w.length.state(),
+		RAM:        w.ram,
+	}
+}
+
+func (w *wave) setState(s WaveState) {
+	w.on = s.On
+	w.dac = s.DAC
+	w.freq = s.Freq
+	w.timer = int(s.Timer)
+	w.pos = s.Pos
+	w.sample = s.Sample
+	w.volumeCode = s.VolumeCode
+	w.length.setState(s.Length)
+	w.ram = s.RAM
+}
+
+func (n *noise) state() NoiseState {
+	return NoiseState{
+		On:      n.on,
+		DAC:     n.dac,
+		Shift:   n.shift,
+		Width7:  n.width7,
+		Divisor: n.divisor,
+		LFSR:    n.lfsr,
+		Timer:   int64(n.timer),
+		Length:  n.length.state(),
+		Env:     n.env.state(),
+	}
+}
+
+func (n *noise) setState(s NoiseState) {
+	n.on = s.On
+	n.dac = s.DAC
+	n.shift = s.Shift
+	n.width7 = s.Width7
+	n.divisor = s.Divisor
+	n.lfsr = s.LFSR
+	n.timer = int(s.Timer)
+	n.length.setState(s.Length)
+	n.env.setState(s.Env)
+}
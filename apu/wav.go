@@ -0,0 +1,97 @@
+package apu
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+)
+
+const wavHeaderSize = 44
+
+// WAVWriter writes 16bit stereo PCM, e.g. to compare the sound of a
+// headless run against a known good recording.
+type WAVWriter struct {
+	w          io.WriteSeeker
+	closer     io.Closer
+	sampleRate int
+	dataSize   uint32
+}
+
+func NewWAVWriter(w io.WriteSeeker, sampleRate int) (*WAVWriter, error) {
+	wav := &WAVWriter{
+		w:          w,
+		sampleRate: sampleRate,
+	}
+	// The sizes are unknown until Close, write a placeholder header for now.
+	if err := wav.writeHeader(); err != nil {
+		return nil, err
+	}
+	return wav, nil
+}
+
+// CreateWAV creates the file name and returns a WAVWriter that closes it.
+func CreateWAV(name string, sampleRate int) (*WAVWriter, error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	wav, err := NewWAVWriter(f, sampleRate)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	wav.closer = f
+	return wav, nil
+}
+
+func (wav *WAVWriter) Write(samples []int16) error {
+	if err := binary.Write(wav.w, binary.LittleEndian, samples); err != nil {
+		return err
+	}
+	wav.dataSize += uint32(len(samples) * 2)
+	return nil
+}
+
+// Close fills in the chunk sizes.
+func (wav *WAVWriter) Close() error {
+	if _, err := wav.w.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := wav.writeHeader(); err != nil {
+		return err
+	}
+	if wav.closer != nil {
+		return wav.closer.Close()
+	}
+	return nil
+}
+
+func (wav *WAVWriter) writeHeader() error {
+	const channels = 2
+	const bitsPerSample = 16
+	blockAlign := channels * bitsPerSample / 8
+
+	header := []interface{}{
+		[4]byte{'R', 'I', 'F', 'F'},
+		uint32(wavHeaderSize - 8 + wav.dataSize),
+		[4]byte{'W', 'A', 'V', 'E'},
+
+		[4]byte{'f', 'm', 't', ' '},
+		uint32(16), // fmt chunk size
+		uint16(1),  // PCM
+		uint16(channels),
+		uint32(wav.sampleRate),
+		uint32(wav.sampleRate * blockAlign), // byte rate
+		uint16(blockAlign),
+		uint16(bitsPerSample),
+
+		[4]byte{'d', 'a', 't', 'a'},
+		wav.dataSize,
+	}
+	for _, v := range header {
+		if err := binary.Write(wav.w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package apu
+
+// NR32 Bit 6-5 - Select output level
+//
+//	0: Mute (No sound)
+//	1: 100% Volume (Produce Wave Pattern RAM Data as it is)
+//	2:  50% Volume (Produce Wave Pattern RAM data shifted once to the right)
+//	3:  25% Volume (Produce Wave Pattern RAM data shifted twice to the right)
+var waveVolumeShift = [4]uint8{4, 0, 1, 2}
+
+// wave is channel 3, which plays the 32 4bit samples in FF30-FF3F.
+type wave struct {
+	on  bool
+	dac bool
+
+	// the timer period is (2048-freq)*2 clocks
+	freq  uint16
+	timer int
+
+	pos    uint8
+	sample uint8
+
+	volumeCode uint8
+	length     lengthCounter
+
+	ram [16]uint8
+}
+
+func newWave() *wave {
+	return &wave{
+		length: lengthCounter{max: 256},
+	}
+}
+
+func (w *wave) step(cycles int) {
+	w.timer -= cycles
+	for w.timer <= 0 {
+		w.timer += w.period()
+		w.pos = (w.pos + 1) % 32
+		w.sample = w.ram[w.pos/2]
+		if w.pos%2 == 0 {
+			w.sample >>= 4
+		}
+		w.sample &= 0x0F
+	}
+}
+
+func (w *wave) period() int {
+	return (2048 - int(w.freq)) * 2
+}
+
+func (w *wave) output() uint8 {
+	if !w.on || !w.dac {
+		return 0
+	}
+	return w.sample >> waveVolumeShift[w.volumeCode]
+}
+
+func (w *wave) writeControl(val uint8) {
+	w.freq = w.freq&0xFF | uint16(val&0x07)<<8
+	w.length.enabled = val&0x40 != 0
+	if val&0x80 != 0 {
+		w.trigger()
+	}
+}
+
+func (w *wave) trigger() {
+	w.on = w.dac
+	w.timer = w.period()
+	w.pos = 0
+	w.length.trigger()
+}
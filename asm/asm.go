@@ -0,0 +1,297 @@
+// Package asm assembles SM83 source into bytes, e.g. to load a small
+// program into memory and step the CPU through it:
+//
+//	code := asm.MustAssemble("LD A,$10\nADD A,B")
+//
+// The instructions are written as in disasm.Templates ("LD [HL+],A",
+// "LDH [$FF44],A", "JR NZ,.loop"), the older spellings like
+// "LDD A,[HL]" and "LD [FF00+C],A" are accepted as well. Memory operands
+// use brackets, parentheses only group expressions (or a register like "(HL)").
+//
+// A line can have a label ("Main:", or ".loop:" local to the last label),
+// an instruction or a directive, and a comment after ";".
+// The directives are
+//
+//	ORG expr         continue at the address expr
+//	DB expr, "text"  bytes
+//	DW expr          little endian words
+//	DS n[, fill]     n bytes of fill (0)
+//	NAME EQU expr    define a constant
+package asm
+
+import (
+	"fmt"
+	"strings"
+	"tgb/disasm"
+)
+
+// Program is the result of Assemble.
+type Program struct {
+	// Address of Bytes[0], the first ORG
+	Origin uint16
+	Bytes  []uint8
+	// Labels, e.g. for the debugger or disasm
+	Symbols disasm.Symbols
+}
+
+type assembler struct {
+	pass int
+
+	origin  uint16
+	started bool
+	out     []uint8
+	// address of the current line
+	lineAddr uint16
+
+	// labels and constants
+	symbols map[string]int
+	labels  disasm.Symbols
+	// the last global label, for the local labels
+	scope string
+	// set by eval when it meets a symbol not defined yet
+	undefined bool
+}
+
+// Assemble assembles src in two passes: the first one finds the addresses
+// of the labels, the second one emits the bytes.
+func Assemble(src string) (*Program, error) {
+	a := &assembler{
+		symbols: map[string]int{},
+		labels:  disasm.Symbols{},
+	}
+	lines := strings.Split(src, "\n")
+	for a.pass = 1; a.pass <= 2; a.pass++ {
+		a.out = nil
+		a.origin = 0
+		a.started = false
+		a.scope = ""
+		for i, line := range lines {
+			if err := a.line(line); err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+		}
+	}
+	return &Program{Origin: a.origin, Bytes: a.out, Symbols: a.labels}, nil
+}
+
+// MustAssemble is like Assemble but panics on errors and only returns
+// the bytes. It is for the programs written in Go source.
+func MustAssemble(src string) []uint8 {
+	p, err := Assemble(src)
+	if err != nil {
+		panic("asm: " + err.Error())
+	}
+	return p.Bytes
+}
+
+func (a *assembler) pc() uint16 {
+	return a.origin + uint16(len(a.out))
+}
+
+func (a *assembler) emit(b ...uint8) {
+	a.started = true
+	a.out = append(a.out, b...)
+}
+
+// fullName returns the name of a local label with its scope, e.g. "Main.loop".
+func (a *assembler) fullName(name string) string {
+	if strings.HasPrefix(name, ".") {
+		return a.scope + name
+	}
+	return name
+}
+
+func (a *assembler) define(name string, v int) error {
+	if _, ok := a.symbols[name]; ok && a.pass == 1 {
+		return fmt.Errorf("%s is already defined", name)
+	}
+	a.symbols[name] = v
+	return nil
+}
+
+func (a *assembler) line(line string) error {
+	a.lineAddr = a.pc()
+	line = strings.TrimSpace(stripComment(line))
+
+	// label
+	if i := strings.Index(line, ":"); i > 0 && isName(strings.TrimRight(line[:i], ":")) {
+		name := strings.TrimRight(line[:i], ":")
+		if !strings.HasPrefix(name, ".") {
+			a.scope = name
+		}
+		name = a.fullName(name)
+		if err := a.define(name, int(a.pc())); err != nil {
+			return err
+		}
+		if _, ok := a.labels[a.pc()]; !ok {
+			a.labels[a.pc()] = name
+		}
+		line = strings.TrimSpace(strings.TrimLeft(line[i:], ":"))
+	}
+	if line == "" {
+		return nil
+	}
+
+	word, rest := line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		word, rest = line[:i], strings.TrimSpace(line[i:])
+	}
+
+	// NAME EQU expr
+	if fields := strings.Fields(rest); len(fields) > 0 && strings.ToUpper(fields[0]) == "EQU" {
+		a.undefined = false
+		v, err := a.eval(strings.TrimSpace(rest[len(fields[0]):]))
+		if err != nil {
+			return err
+		}
+		if a.undefined {
+			return fmt.Errorf("%s has to be defined before EQU", rest)
+		}
+		return a.define(word, v)
+	}
+
+	args := splitOperands(rest)
+	switch strings.ToUpper(word) {
+	case "ORG":
+		return a.org(args)
+	case "DB":
+		return a.db(args)
+	case "DW":
+		for _, arg := range args {
+			if err := a.emit16(arg); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "DS":
+		return a.ds(args)
+	}
+	return a.instruction(word, args)
+}
+
+func (a *assembler) org(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("ORG takes an address")
+	}
+	a.undefined = false
+	v, err := a.eval(args[0])
+	if err != nil {
+		return err
+	}
+	if a.undefined {
+		return fmt.Errorf("%s has to be defined before ORG", args[0])
+	}
+	if v < 0 || 0xFFFF < v {
+		return fmt.Errorf("ORG %s is not an address", args[0])
+	}
+
+	if !a.started {
+		a.origin = uint16(v)
+		a.started = true
+		return nil
+	}
+	if v < int(a.pc()) {
+		return fmt.Errorf("ORG $%04X is before the current address $%04X", v, a.pc())
+	}
+	for int(a.pc()) < v {
+		a.emit(0x00)
+	}
+	return nil
+}
+
+func (a *assembler) db(args []string) error {
+	for _, arg := range args {
+		if len(arg) >= 2 && arg[0] == '"' && arg[len(arg)-1] == '"' {
+			a.emit([]uint8(arg[1 : len(arg)-1])...)
+			continue
+		}
+		if err := a.emit8(arg, -0x80, 0xFF); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *assembler) ds(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf("DS takes a size and optionally a fill byte")
+	}
+	a.undefined = false
+	n, err := a.eval(args[0])
+	if err != nil {
+		return err
+	}
+	if a.undefined || n < 0 {
+		return fmt.Errorf("bad size %s", args[0])
+	}
+	fill := 0
+	if len(args) == 2 {
+		if fill, err = a.eval(args[1]); err != nil {
+			return err
+		}
+	}
+	for i := 0; i < n; i++ {
+		a.emit(uint8(fill))
+	}
+	return nil
+}
+
+// stripComment removes the comment after ";" outside of strings and characters.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ';':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// splitOperands splits s at the commas outside of strings, brackets and parentheses.
+func splitOperands(s string) []string {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	var args []string
+	var quote byte
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '(':
+			depth++
+		case c == ']' || c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			args = append(args, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	return append(args, strings.TrimSpace(s[start:]))
+}
+
+func isName(s string) bool {
+	if s == "" || !(s[0] == '.' || s[0] == '_' || isLetter(s[0])) {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isSymbolChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
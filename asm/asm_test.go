@@ -0,0 +1,184 @@
+package asm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"tgb/cpu"
+	"tgb/disasm"
+	"tgb/interrupt"
+	"tgb/memory"
+)
+
+// Every instruction disassembled with disasm has to assemble to the same bytes.
+func TestRoundTrip(t *testing.T) {
+	var codes [][]uint8
+	for op := 0; op < 0x100; op++ {
+		switch op {
+		case 0xCB:
+		case 0x10:
+			// STOP is shown without its second byte, which is 00
+			codes = append(codes, []uint8{0x10, 0x00})
+		default:
+			codes = append(codes, []uint8{uint8(op), 0x12, 0x34})
+		}
+		codes = append(codes, []uint8{0xCB, uint8(op)})
+	}
+
+	for _, code := range codes {
+		in := disasm.DecodeBytes(code, 0x0150)
+		if !in.Valid() {
+			continue
+		}
+		text := in.Text(nil)
+		p, err := Assemble("ORG $0150\n" + text)
+		if err != nil {
+			t.Errorf("%s (%s): %v", text, in.Hex(), err)
+			continue
+		}
+		if !bytes.Equal(p.Bytes, in.Bytes) {
+			t.Errorf("%s: got % X, want % X", text, p.Bytes, in.Bytes)
+		}
+	}
+}
+
+// RST only takes the address of the vector, not its number.
+func TestRST(t *testing.T) {
+	p, err := Assemble("RST $38")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(p.Bytes, []uint8{0xFF}) {
+		t.Errorf("RST $38: got % X, want FF", p.Bytes)
+	}
+	for _, src := range []string{"RST 7", "RST $39"} {
+		_, err := Assemble(src)
+		if err == nil || !strings.Contains(err.Error(), "address of the vector") {
+			t.Errorf("%s: got error %v", src, err)
+		}
+	}
+}
+
+// runCPU loads code at 0100 and steps the CPU through steps instructions.
+func runCPU(t *testing.T, code string, r cpu.Registers, steps int) cpu.Registers {
+	t.Helper()
+	mem := memory.New()
+	copy(mem.Data[0x0100:], MustAssemble("ORG $0100\n"+code))
+
+	c := cpu.NewCPU(mem, interrupt.New(mem))
+	r.PC = 0x0100
+	r.SP = 0xFFFE
+	c.Set(r)
+	for i := 0; i < steps; i++ {
+		c.Step()
+	}
+	return c.Get()
+}
+
+func TestCPU(t *testing.T) {
+	tests := []struct {
+		name  string
+		code  string
+		init  cpu.Registers
+		steps int
+		check func(r cpu.Registers) bool
+	}{
+		{
+			name:  "ADD",
+			code:  "LD A,$10\nADD A,B",
+			init:  cpu.Registers{B: 0x05},
+			steps: 2,
+			check: func(r cpu.Registers) bool {
+				return r.A == 0x15 && !r.ZeroFlag() && !r.SubFlag() && !r.HalfCarryFlag() && !r.CarryFlag()
+			},
+		},
+		{
+			name:  "ADD half carry",
+			code:  "LD A,$0F\nADD A,B",
+			init:  cpu.Registers{B: 0x01},
+			steps: 2,
+			check: func(r cpu.Registers) bool {
+				return r.A == 0x10 && !r.ZeroFlag() && !r.SubFlag() && r.HalfCarryFlag() && !r.CarryFlag()
+			},
+		},
+		{
+			name:  "SUB",
+			code:  "LD A,$15\nSUB A,B",
+			init:  cpu.Registers{B: 0x05},
+			steps: 2,
+			check: func(r cpu.Registers) bool {
+				return r.A == 0x10 && !r.ZeroFlag() && r.SubFlag() && !r.HalfCarryFlag() && !r.CarryFlag()
+			},
+		},
+		{
+			name:  "SUB half borrow",
+			code:  "LD A,$10\nSUB A,B",
+			init:  cpu.Registers{B: 0x01},
+			steps: 2,
+			check: func(r cpu.Registers) bool {
+				return r.A == 0x0F && !r.ZeroFlag() && r.SubFlag() && r.HalfCarryFlag() && !r.CarryFlag()
+			},
+		},
+		{
+			name:  "SUB borrow",
+			code:  "LD A,$01\nSUB A,B",
+			init:  cpu.Registers{B: 0x02},
+			steps: 2,
+			check: func(r cpu.Registers) bool {
+				return r.A == 0xFF && !r.ZeroFlag() && r.SubFlag() && r.HalfCarryFlag() && r.CarryFlag()
+			},
+		},
+		{
+			name:  "DEC",
+			code:  "DEC B",
+			init:  cpu.Registers{B: 0x11},
+			steps: 1,
+			check: func(r cpu.Registers) bool {
+				return r.B == 0x10 && !r.ZeroFlag() && r.SubFlag() && !r.HalfCarryFlag()
+			},
+		},
+		{
+			name:  "DEC half borrow",
+			code:  "DEC B",
+			init:  cpu.Registers{B: 0x10},
+			steps: 1,
+			check: func(r cpu.Registers) bool {
+				return r.B == 0x0F && !r.ZeroFlag() && r.SubFlag() && r.HalfCarryFlag()
+			},
+		},
+		{
+			name: "loop",
+			code: `
+	XOR A
+	LD B,3
+.loop:
+	ADD A,C
+	DEC B
+	JR NZ,.loop
+	LD D,A`,
+			init:  cpu.Registers{C: 0x07},
+			steps: 2 + 3*3 + 1,
+			check: func(r cpu.Registers) bool {
+				return r.A == 21 && r.B == 0 && r.D == 21 && r.PC == 0x0108
+			},
+		},
+		{
+			name:  "CB",
+			code:  "SWAP B\nBIT 7,B\nSET 0,C",
+			init:  cpu.Registers{B: 0x1E, C: 0x00},
+			steps: 3,
+			check: func(r cpu.Registers) bool {
+				return r.B == 0xE1 && !r.ZeroFlag() && r.HalfCarryFlag() && r.C == 0x01
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := runCPU(t, tt.code, tt.init, tt.steps)
+			if !tt.check(r) {
+				t.Errorf("%s F=%02X B=%02X C=%02X D=%02X", r, r.F, r.B, r.C, r.D)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package asm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// expr is an expression being parsed. The operators and their precedence
+// are those of C: | ^ & << >> + - * / % and unary - + ~, with parentheses.
+type expr struct {
+	a   *assembler
+	s   string
+	pos int
+}
+
+// eval evaluates s. The numbers can be written as $FF, 0xFF, %1010, 255
+// or 'A', @ is the address of the current line. In the first pass an
+// undefined symbol is 0 and sets a.undefined, the label may come later.
+func (a *assembler) eval(s string) (int, error) {
+	e := &expr{a: a, s: s}
+	v, err := e.binary(0)
+	if err != nil {
+		return 0, err
+	}
+	e.skipSpaces()
+	if e.pos < len(e.s) {
+		return 0, fmt.Errorf("unexpected %q in %q", e.s[e.pos:], s)
+	}
+	return v, nil
+}
+
+var precedence = map[string]int{
+	"|":  1,
+	"^":  2,
+	"&":  3,
+	"<<": 4, ">>": 4,
+	"+": 5, "-": 5,
+	"*": 6, "/": 6, "%": 6,
+}
+
+func (e *expr) skipSpaces() {
+	for e.pos < len(e.s) && (e.s[e.pos] == ' ' || e.s[e.pos] == '\t') {
+		e.pos++
+	}
+}
+
+// operator returns the binary operator at pos.
+func (e *expr) operator() string {
+	e.skipSpaces()
+	rest := e.s[e.pos:]
+	for _, op := range []string{"<<", ">>"} {
+		if strings.HasPrefix(rest, op) {
+			return op
+		}
+	}
+	if rest != "" {
+		if _, ok := precedence[rest[:1]]; ok {
+			return rest[:1]
+		}
+	}
+	return ""
+}
+
+// binary parses the operators with a precedence above min.
+func (e *expr) binary(min int) (int, error) {
+	lhs, err := e.unary()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := e.operator()
+		if op == "" || precedence[op] <= min {
+			return lhs, nil
+		}
+		e.pos += len(op)
+		rhs, err := e.binary(precedence[op])
+		if err != nil {
+			return 0, err
+		}
+
+		switch op {
+		case "|":
+			lhs |= rhs
+		case "^":
+			lhs ^= rhs
+		case "&":
+			lhs &= rhs
+		case "<<":
+			lhs <<= uint(rhs)
+		case ">>":
+			lhs >>= uint(rhs)
+		case "+":
+			lhs += rhs
+		case "-":
+			lhs -= rhs
+		case "*":
+			lhs *= rhs
+		case "/", "%":
+			if rhs == 0 {
+				return 0, fmt.Errorf("division by zero in %q", e.s)
+			}
+			if op == "/" {
+				lhs /= rhs
+			} else {
+				lhs %= rhs
+			}
+		}
+	}
+}
+
+func (e *expr) unary() (int, error) {
+	e.skipSpaces()
+	if e.pos >= len(e.s) {
+		return 0, fmt.Errorf("missing value in %q", e.s)
+	}
+
+	switch c := e.s[e.pos]; {
+	case c == '-' || c == '+' || c == '~':
+		e.pos++
+		v, err := e.unary()
+		switch c {
+		case '-':
+			v = -v
+		case '~':
+			v = ^v
+		}
+		return v, err
+	case c == '(':
+		e.pos++
+		v, err := e.binary(0)
+		if err != nil {
+			return 0, err
+		}
+		e.skipSpaces()
+		if e.pos >= len(e.s) || e.s[e.pos] != ')' {
+			return 0, fmt.Errorf("missing ) in %q", e.s)
+		}
+		e.pos++
+		return v, nil
+	case c == '@':
+		e.pos++
+		return int(e.a.lineAddr), nil
+	case c == '\'':
+		if e.pos+2 >= len(e.s) || e.s[e.pos+2] != '\'' {
+			return 0, fmt.Errorf("bad character in %q", e.s)
+		}
+		v := int(e.s[e.pos+1])
+		e.pos += 3
+		return v, nil
+	case c == '$' || c == '%' || '0' <= c && c <= '9':
+		return e.number()
+	case c == '.' || c == '_' || isLetter(c):
+		return e.symbol()
+	}
+	return 0, fmt.Errorf("unexpected %q in %q", e.s[e.pos:], e.s)
+}
+
+func (e *expr) number() (int, error) {
+	start := e.pos
+	for e.pos < len(e.s) && (e.pos == start || isLetter(e.s[e.pos]) || '0' <= e.s[e.pos] && e.s[e.pos] <= '9') {
+		e.pos++
+	}
+	text := e.s[start:e.pos]
+
+	var v uint64
+	var err error
+	switch {
+	case strings.HasPrefix(text, "$"):
+		v, err = strconv.ParseUint(text[1:], 16, 32)
+	case strings.HasPrefix(text, "%"):
+		v, err = strconv.ParseUint(text[1:], 2, 32)
+	case strings.HasPrefix(text, "0x") || strings.HasPrefix(text, "0X"):
+		v, err = strconv.ParseUint(text[2:], 16, 32)
+	default:
+		// not octal with a leading 0
+		v, err = strconv.ParseUint(text, 10, 32)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("bad number %q", text)
+	}
+	return int(v), nil
+}
+
+func (e *expr) symbol() (int, error) {
+	start := e.pos
+	for e.pos < len(e.s) && isSymbolChar(e.s[e.pos]) {
+		e.pos++
+	}
+	name := e.a.fullName(e.s[start:e.pos])
+	if v, ok := e.a.symbols[name]; ok {
+		return v, nil
+	}
+	if e.a.pass == 1 {
+		e.a.undefined = true
+		return 0, nil
+	}
+	return 0, fmt.Errorf("undefined symbol %s", name)
+}
+
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isSymbolChar(c byte) bool {
+	return isLetter(c) || '0' <= c && c <= '9' || c == '_' || c == '.'
+}
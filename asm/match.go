@@ -0,0 +1,306 @@
+package asm
+
+import (
+	"fmt"
+	"strings"
+	"tgb/cpu"
+	"tgb/disasm"
+)
+
+// form is an instruction as written in disasm.Templates,
+// e.g. opcode 0x01 "LD BC,n16" has the operands "BC" and "n16".
+type form struct {
+	opcode   uint8
+	cb       bool
+	operands []string
+}
+
+// forms are the instructions of each mnemonic.
+var forms = buildForms()
+
+func buildForms() map[string][]form {
+	m := map[string][]form{}
+	add := func(template string, op int, cb bool) {
+		if template == "" {
+			return
+		}
+		f := form{opcode: uint8(op), cb: cb}
+		mnemonic := template
+		if i := strings.Index(template, " "); i >= 0 {
+			mnemonic = template[:i]
+			f.operands = strings.Split(template[i+1:], ",")
+		}
+		m[mnemonic] = append(m[mnemonic], f)
+	}
+	for op, t := range disasm.Templates {
+		add(t, op, false)
+	}
+	for op, t := range disasm.CBTemplates {
+		add(t, op, true)
+	}
+	return m
+}
+
+// The operands that aren't an expression.
+var reserved = map[string]bool{
+	"A": true, "B": true, "C": true, "D": true, "E": true, "H": true, "L": true,
+	"AF": true, "BC": true, "DE": true, "HL": true, "SP": true,
+	"NZ": true, "Z": true, "NC": true,
+	"[BC]": true, "[DE]": true, "[HL]": true, "[HL+]": true, "[HL-]": true, "[C]": true,
+}
+
+// memoryRegisters are the other ways to write the register operands in brackets.
+var memoryRegisters = map[string]string{
+	"BC":      "[BC]",
+	"DE":      "[DE]",
+	"HL":      "[HL]",
+	"HL+":     "[HL+]",
+	"HLI":     "[HL+]",
+	"HL-":     "[HL-]",
+	"HLD":     "[HL-]",
+	"C":       "[C]",
+	"FF00+C":  "[C]",
+	"$FF00+C": "[C]",
+}
+
+// normalize writes an operand the way the templates do: the registers in
+// upper case, "[HL+]" for "(HLI)" and "[C]" for "[FF00+C]".
+func normalize(s string) string {
+	s = strings.TrimSpace(s)
+	compact := strings.ToUpper(strings.Join(strings.Fields(s), ""))
+
+	if len(compact) > 2 && (compact[0] == '[' && compact[len(compact)-1] == ']' ||
+		compact[0] == '(' && compact[len(compact)-1] == ')') {
+		if r, ok := memoryRegisters[compact[1:len(compact)-1]]; ok {
+			return r
+		}
+		return s
+	}
+	if reserved[compact] {
+		return compact
+	}
+	if strings.HasPrefix(compact, "SP+") || strings.HasPrefix(compact, "SP-") {
+		return "SP" + strings.TrimSpace(strings.TrimSpace(s)[2:])
+	}
+	return s
+}
+
+func isMemory(s string) bool {
+	return strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") && !reserved[s]
+}
+
+func isSPOffset(s string) bool {
+	return strings.HasPrefix(s, "SP+") || strings.HasPrefix(s, "SP-")
+}
+
+func isImmediate(s string) bool {
+	return !reserved[s] && !isMemory(s) && !isSPOffset(s)
+}
+
+// aliases rewrites the other spellings of some instructions, e.g.
+// "LDI A,[HL]" or "LD [FF00+C],A", and "SUB B" without A.
+func aliases(mnemonic string, operands []string) (string, []string) {
+	switch mnemonic {
+	case "LDI", "LDD":
+		sign := "+"
+		if mnemonic == "LDD" {
+			sign = "-"
+		}
+		for i, op := range operands {
+			if op == "[HL]" {
+				operands[i] = "[HL" + sign + "]"
+			}
+		}
+		mnemonic = "LD"
+	case "ADD", "ADC", "SUB", "SBC", "AND", "XOR", "OR", "CP":
+		if len(operands) == 1 {
+			operands = append([]string{"A"}, operands...)
+		}
+	case "JP":
+		if len(operands) == 1 && operands[0] == "[HL]" {
+			operands[0] = "HL"
+		}
+	}
+	if mnemonic == "LD" {
+		for _, op := range operands {
+			if op == "[C]" {
+				mnemonic = "LDH"
+			}
+		}
+	}
+	return mnemonic, operands
+}
+
+// instruction assembles one instruction.
+func (a *assembler) instruction(mnemonic string, args []string) error {
+	operands := make([]string, len(args))
+	for i, arg := range args {
+		operands[i] = normalize(arg)
+	}
+	mnemonic, operands = aliases(strings.ToUpper(mnemonic), operands)
+
+	candidates, ok := forms[mnemonic]
+	if !ok {
+		return fmt.Errorf("unknown instruction %s", mnemonic)
+	}
+	for _, f := range candidates {
+		ok, err := a.matches(f, operands)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return a.encode(f, operands)
+		}
+	}
+	if mnemonic == "RST" {
+		// As in RGBDS, "RST 7" isn't the 8th vector.
+		return fmt.Errorf("RST takes the address of the vector ($00, $08, ..., $38), not %s", strings.Join(operands, ","))
+	}
+	return fmt.Errorf("no form of %s takes %s", mnemonic, strings.Join(operands, ","))
+}
+
+func (a *assembler) matches(f form, operands []string) (bool, error) {
+	if len(f.operands) != len(operands) {
+		return false, nil
+	}
+	for i, t := range f.operands {
+		s := operands[i]
+		switch {
+		case t == "n8" || t == "n16" || t == "a16" || t == "e8":
+			if !isImmediate(s) {
+				return false, nil
+			}
+		case t == "[a16]" || t == "[a8]":
+			if !isMemory(s) {
+				return false, nil
+			}
+		case t == "SP+e8":
+			if !isSPOffset(s) {
+				return false, nil
+			}
+		case strings.HasPrefix(t, "$") || '0' <= t[0] && t[0] <= '9':
+			// RST $38 and BIT 7,A take a constant
+			if !isImmediate(s) {
+				return false, nil
+			}
+			want, err := a.eval(t)
+			if err != nil {
+				return false, err
+			}
+			a.undefined = false
+			got, err := a.eval(s)
+			if err != nil {
+				return false, err
+			}
+			if a.undefined {
+				return false, fmt.Errorf("%s has to be defined before it is used here", s)
+			}
+			if got != want {
+				return false, nil
+			}
+		default:
+			if s != t {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+// encode emits the opcode and the operands of f.
+func (a *assembler) encode(f form, operands []string) error {
+	if f.cb {
+		a.emit(0xCB, f.opcode)
+		return nil
+	}
+	start := len(a.out)
+	a.emit(f.opcode)
+	next := int(a.lineAddr) + 1 + cpu.OperandLength(f.opcode)
+
+	for i, t := range f.operands {
+		s := operands[i]
+		var err error
+		switch t {
+		case "n8":
+			err = a.emit8(s, -0x80, 0xFF)
+		case "n16", "a16":
+			err = a.emit16(s)
+		case "[a16]":
+			err = a.emit16(s[1 : len(s)-1])
+		case "[a8]":
+			err = a.emitHigh(s[1 : len(s)-1])
+		case "SP+e8":
+			err = a.emit8(s[2:], -0x80, 0x7F)
+		case "e8":
+			if f.opcode == 0xE8 {
+				// ADD SP,e8
+				err = a.emit8(s, -0x80, 0x7F)
+			} else {
+				err = a.emitRelative(s, next)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// STOP is followed by a 0.
+	for len(a.out)-start < 1+cpu.OperandLength(f.opcode) {
+		a.emit(0x00)
+	}
+	return nil
+}
+
+func (a *assembler) emit8(s string, min, max int) error {
+	v, err := a.eval(s)
+	if err != nil {
+		return err
+	}
+	if a.pass == 2 && (v < min || max < v) {
+		return fmt.Errorf("%s = %d doesn't fit in a byte", s, v)
+	}
+	a.emit(uint8(v))
+	return nil
+}
+
+func (a *assembler) emit16(s string) error {
+	v, err := a.eval(s)
+	if err != nil {
+		return err
+	}
+	if a.pass == 2 && (v < -0x8000 || 0xFFFF < v) {
+		return fmt.Errorf("%s = %d doesn't fit in a word", s, v)
+	}
+	a.emit(uint8(v), uint8(v>>8))
+	return nil
+}
+
+// emitHigh emits the operand of LDH, which is either FF00-FFFF or 00-FF.
+func (a *assembler) emitHigh(s string) error {
+	v, err := a.eval(s)
+	if err != nil {
+		return err
+	}
+	if 0xFF00 <= v && v <= 0xFFFF {
+		v -= 0xFF00
+	}
+	if a.pass == 2 && (v < 0 || 0xFF < v) {
+		return fmt.Errorf("LDH can't reach %s", s)
+	}
+	a.emit(uint8(v))
+	return nil
+}
+
+// emitRelative emits the offset of JR from next to the address s.
+func (a *assembler) emitRelative(s string, next int) error {
+	v, err := a.eval(s)
+	if err != nil {
+		return err
+	}
+	offset := v - next
+	if a.pass == 2 && (offset < -0x80 || 0x7F < offset) {
+		return fmt.Errorf("%s is too far for JR", s)
+	}
+	a.emit(uint8(offset))
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"tgb/model"
+	"tgb/runner"
+)
+
+func conformanceCommand(args []string) error {
+	fs := flag.NewFlagSet("conformance", flag.ExitOnError)
+	frames := fs.Int("frames", runner.DEFAULT_FRAMES, "frames before a ROM times out")
+	modelName := fs.String("model", "auto", "hardware model: auto, dmg0, dmg, mgb, sgb, cgb or agb")
+	format := fs.String("format", "markdown", "output format: markdown or json")
+	output := fs.String("o", "", "write the report to this file instead of stdout")
+	hashesPath := fs.String("hashes", "", "screen hashes of the passing ROMs (default <dir>/hashes.txt if it exists)")
+	bootROM := fs.String("bootrom", "", "DMG boot ROM to run before each ROM")
+	writeHashes := fs.String("write-hashes", "", "write the known hashes and the last screens of the ROMs that timed out to this file")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("conformance: expected a directory of test ROMs")
+	}
+	dir := fs.Arg(0)
+
+	m, err := model.Parse(*modelName)
+	if err != nil {
+		return err
+	}
+	opt := runner.Options{Frames: *frames, Model: m, BootROM: *bootROM}
+
+	path := *hashesPath
+	if path == "" {
+		if _, err := os.Stat(filepath.Join(dir, "hashes.txt")); err == nil {
+			path = filepath.Join(dir, "hashes.txt")
+		}
+	}
+	if path != "" {
+		if opt.Hashes, err = runner.LoadHashes(path); err != nil {
+			return err
+		}
+	}
+
+	results, err := runner.RunDir(dir, opt)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	switch *format {
+	case "markdown", "md":
+		err = runner.WriteMarkdown(w, results)
+	case "json":
+		err = runner.WriteJSON(w, results)
+	default:
+		return fmt.Errorf("conformance: unknown format %q", *format)
+	}
+	if err != nil {
+		return err
+	}
+
+	if *writeHashes != "" {
+		f, err := os.Create(*writeHashes)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := runner.WriteHashes(f, opt.Hashes, results); err != nil {
+			return err
+		}
+	}
+	if *output != "" || *format != "markdown" && *format != "md" {
+		fmt.Fprintln(os.Stderr, runner.Summary(results))
+	}
+	return nil
+}
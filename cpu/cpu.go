@@ -1,10 +1,10 @@
 package cpu
 
 import (
-	"fmt"
 	"log"
 	"tgb/interrupt"
 	"tgb/memory"
+	"tgb/model"
 	// "tgb/interrupt"
 )
 
@@ -26,47 +26,85 @@ type CPU struct {
 	iFlag uint16 // Interrupt Flag
 
 	cycle int
+	// set by HALT until an interrupt is pending
+	halted bool
+
+	// CGB speed switch, see KEY1
+	doubleSpeed        bool
+	prepareSpeedSwitch bool
+
+	mem *memory.Memory
+	irq *interrupt.Interrupt
+
+	// Watch, if set, is called for every memory access of the CPU,
+	// e.g. by the debugger.
+	Watch func(addr uint16, val uint8, write bool)
 }
 
 type opcode uint8
 
-func NewCPUinBoot() *CPU {
+func NewCPUinBoot(mem *memory.Memory, irq *interrupt.Interrupt) *CPU {
 	cpu := &CPU {
 		pc: 0x0000,
 		cycle: 0,
+		mem: mem,
+		irq: irq,
 	}
 	return cpu
 }
 
-func NewCPU() *CPU {
-	// only normal GB
-	cpu := &CPU{
-		a:     0x01,
-		f:     0xB0,
-		b:     0x00,
-		c:     0x13,
-		d:     0x00,
-		e:     0xD8,
-		h:     0x01,
-		l:     0x4D,
-		sp:    0xFFFE,
-		pc:    0x0100,
-		cycle: 0,
+// NewCPU returns the CPU as the boot ROM of a DMG leaves it for a
+// cartridge whose header checksum isn't 0x00, i.e. with H and C set.
+func NewCPU(mem *memory.Memory, irq *interrupt.Interrupt) *CPU {
+	return NewCPUFor(mem, irq, model.DMG, 0xFF)
+}
+
+// Registers left by the boot ROM of each model.
+var bootRegistersTable = map[model.Model]Registers{
+	model.DMG0: {A: 0x01, F: 0x00, B: 0xFF, C: 0x13, D: 0x00, E: 0xC1, H: 0x84, L: 0x03, SP: 0xFFFE, PC: 0x0100},
+	model.DMG:  {A: 0x01, F: 0x80, B: 0x00, C: 0x13, D: 0x00, E: 0xD8, H: 0x01, L: 0x4D, SP: 0xFFFE, PC: 0x0100},
+	model.MGB:  {A: 0xFF, F: 0x80, B: 0x00, C: 0x13, D: 0x00, E: 0xD8, H: 0x01, L: 0x4D, SP: 0xFFFE, PC: 0x0100},
+	model.SGB:  {A: 0x01, F: 0x00, B: 0x00, C: 0x14, D: 0x00, E: 0x00, H: 0xC0, L: 0x60, SP: 0xFFFE, PC: 0x0100},
+	model.CGB:  {A: 0x11, F: 0x80, B: 0x00, C: 0x00, D: 0xFF, E: 0x56, H: 0x00, L: 0x0D, SP: 0xFFFE, PC: 0x0100},
+	model.AGB:  {A: 0x11, F: 0x00, B: 0x01, C: 0x00, D: 0xFF, E: 0x56, H: 0x00, L: 0x0D, SP: 0xFFFE, PC: 0x0100},
+}
+
+// NewCPUFor returns the CPU as the boot ROM of m leaves it.
+// headerChecksum is 0x014D of the cartridge: on DMG and MGB the
+// H and C flags are set unless it is 0x00.
+func NewCPUFor(mem *memory.Memory, irq *interrupt.Interrupt, m model.Model, headerChecksum uint8) *CPU {
+	r, ok := bootRegistersTable[m]
+	if !ok {
+		r = bootRegistersTable[model.DMG]
+	}
+	if (m == model.DMG || m == model.MGB) && headerChecksum != 0x00 {
+		r.F |= 0x30
 	}
 
+	cpu := &CPU{mem: mem, irq: irq}
+	cpu.Set(r)
 	return cpu
 }
 
 // (fetch - decode - execute) 1 cycle
 func (cpu *CPU) Step() int {
+	if cpu.halted {
+		// (IE & IF & 1F) != 0 となるまで、CPUは停止される
+		if cpu.irq.Pending() == 0 {
+			return 1
+		}
+		cpu.halted = false
+	}
 	inst, operands := cpu.fetch()
 	cpu.decodeAndExecute(inst, operands)
+	if inst == 0xCB {
+		return cpu.cycle
+	}
 	return opcodeCycles[inst]
 }
 
 func (cpu *CPU) fetch() (opcode, []uint8) {
 	inst := opcode(cpu.read(cpu.pc))
-	fmt.Printf("%s  ", opcodeLabels[inst])
 
 	cpu.pc++
 
@@ -98,8 +136,7 @@ func (cpu *CPU) decodeAndExecute(inst opcode, operands []uint8) {
 		cpu.write(cpu.bc(), cpu.a)
 
 	case 0x03: // INC BC
-		n := cpu.read(cpu.bc())
-		cpu.write(cpu.bc(), n+1)
+		cpu.set_bc(cpu.bc() + 1)
 
 	case 0x04: // INC B
 		cpu.modifyFlagsInIncOP(cpu.b+1, "INC")
@@ -121,15 +158,14 @@ func (cpu *CPU) decodeAndExecute(inst opcode, operands []uint8) {
 		cpu.write(u8tou16(lsb, msb), cpu.read(cpu.sp))
 
 	case 0x09: // ADD HL, BC
-		cpu.modifyFlagsAddHL(int(cpu.hl()) + int(cpu.bc()))
-		// cpu.write(cpu.hl(), cpu.hl()+cpu.bc())
+		cpu.modifyFlagsAddHL(cpu.hl(), cpu.bc())
+		cpu.set_hl(cpu.hl() + cpu.bc())
 
 	case 0x0A: // LD A, [BC]
 		cpu.a = cpu.read(cpu.bc())
 
 	case 0x0B: // DEC BC
-		n := cpu.read(cpu.bc())
-		cpu.write(cpu.bc(), n-1)
+		cpu.set_bc(cpu.bc() - 1)
 
 	case 0x0C: // INC C
 		cpu.modifyFlagsInIncOP(cpu.c+1, "INC")
@@ -154,8 +190,7 @@ func (cpu *CPU) decodeAndExecute(inst opcode, operands []uint8) {
 		cpu.write(cpu.de(), cpu.a)
 
 	case 0x13: // INC DE
-		n := cpu.read(cpu.de())
-		cpu.write(cpu.de(), n+1)
+		cpu.set_de(cpu.de() + 1)
 
 	case 0x14: // INC D
 		cpu.modifyFlagsInIncOP(cpu.d+1, "INC")
@@ -173,18 +208,17 @@ func (cpu *CPU) decodeAndExecute(inst opcode, operands []uint8) {
 
 	case 0x18: // JR r
 		r := operands[0]
-		cpu.pc += uint16(int16(r))
+		cpu.pc += uint16(int8(r))
 
 	case 0x19: // ADD HL, DE
-		cpu.modifyFlagsAddHL(int(cpu.hl()) + int(cpu.de()))
-		// cpu.write(cpu.hl(), cpu.hl()+cpu.de())
+		cpu.modifyFlagsAddHL(cpu.hl(), cpu.de())
+		cpu.set_hl(cpu.hl() + cpu.de())
 
 	case 0x1A: // LD A, [DE]
 		cpu.a = cpu.read(cpu.de())
 
 	case 0x1B: // DEC DE
-		n := cpu.read(cpu.de())
-		cpu.write(cpu.de(), n-1)
+		cpu.set_de(cpu.de() - 1)
 
 	case 0x1C: // INC E
 		cpu.modifyFlagsInIncOP(cpu.e+1, "INC")
@@ -203,7 +237,7 @@ func (cpu *CPU) decodeAndExecute(inst opcode, operands []uint8) {
 	case 0x20: // JR NZ, r
 		r := operands[0]
 		if !cpu.isZeroFlag() {
-			cpu.pc += uint16(int16(r))
+			cpu.pc += uint16(int8(r))
 		}
 
 	case 0x21: // LD HL, nn
@@ -216,8 +250,7 @@ func (cpu *CPU) decodeAndExecute(inst opcode, operands []uint8) {
 		cpu.set_hl(cpu.hl() + 1)
 
 	case 0x23: // INC HL
-		n := cpu.read(cpu.hl())
-		cpu.write(cpu.hl(), n+1)
+		cpu.set_hl(cpu.hl() + 1)
 
 	case 0x24: // INC H
 		cpu.modifyFlagsInIncOP(cpu.h+1, "INC")
@@ -233,20 +266,19 @@ func (cpu *CPU) decodeAndExecute(inst opcode, operands []uint8) {
 	case 0x28: // JR Z, r
 		r := operands[0]
 		if cpu.isZeroFlag() {
-			cpu.pc += uint16(int16(r))
+			cpu.pc += uint16(int8(r))
 		}
 
 	case 0x29: // ADD HL, HL
-		cpu.modifyFlagsAddHL(int(cpu.hl()) + int(cpu.hl()))
-		//cpu.write(cpu.hl(), cpu.hl()+cpu.hl())
+		cpu.modifyFlagsAddHL(cpu.hl(), cpu.hl())
+		cpu.set_hl(cpu.hl() + cpu.hl())
 
 	case 0x2A: // LDI A, [HL+]
 		cpu.a = cpu.read(cpu.hl())
 		cpu.set_hl(cpu.hl() + 1)
 
 	case 0x2B: // DEC HL
-		n := cpu.read(cpu.hl())
-		cpu.write(cpu.hl(), n-1)
+		cpu.set_hl(cpu.hl() - 1)
 
 	case 0x2C: // INC L
 		cpu.modifyFlagsInIncOP(cpu.l+1, "INC")
@@ -267,7 +299,7 @@ func (cpu *CPU) decodeAndExecute(inst opcode, operands []uint8) {
 	case 0x30: // JR NC, r
 		r := operands[0]
 		if !cpu.isCarryFlag() {
-			cpu.pc += uint16(int16(r))
+			cpu.pc += uint16(int8(r))
 		}
 
 	case 0x31: // LD SP, nn
@@ -280,8 +312,7 @@ func (cpu *CPU) decodeAndExecute(inst opcode, operands []uint8) {
 		cpu.set_hl(cpu.hl() - 1)
 
 	case 0x33: // INC SP
-		n := cpu.read(cpu.sp)
-		cpu.write(cpu.sp, n+1)
+		cpu.sp++
 
 	case 0x34: // INC [HL]
 		n := cpu.read(cpu.hl())
@@ -304,20 +335,19 @@ func (cpu *CPU) decodeAndExecute(inst opcode, operands []uint8) {
 	case 0x38: // JR C, r
 		r := operands[0]
 		if cpu.isCarryFlag() {
-			cpu.pc += uint16(int16(r))
+			cpu.pc += uint16(int8(r))
 		}
 
 	case 0x39: // ADD HL, SP
-		cpu.modifyFlagsAddHL(int(cpu.hl()) + int(cpu.sp))
-		// cpu.write(cpu.hl(), cpu.hl()+cpu.sp)
+		cpu.modifyFlagsAddHL(cpu.hl(), cpu.sp)
+		cpu.set_hl(cpu.hl() + cpu.sp)
 
 	case 0x3A: // LDD A, [HL-]
 		cpu.a = cpu.read(cpu.hl())
 		cpu.set_hl(cpu.hl() - 1)
 
 	case 0x3B: // DEC SP
-		n := cpu.read(cpu.sp)
-		cpu.write(cpu.sp, n-1)
+		cpu.sp--
 
 	case 0x3C: // INC A
 		cpu.modifyFlagsInIncOP(cpu.a+1, "INC")
@@ -536,135 +566,135 @@ func (cpu *CPU) decodeAndExecute(inst opcode, operands []uint8) {
 		cpu.a = cpu.a
 
 	case 0x80: // ADD A, B
-		cpu.modifyFlags(int(cpu.a)+int(cpu.b), "+")
+		cpu.modifyFlags(cpu.a, cpu.b, 0, "+")
 		cpu.a += cpu.b
 
 	case 0x81: // ADD A, C
-		cpu.modifyFlags(int(cpu.a)+int(cpu.c), "+")
+		cpu.modifyFlags(cpu.a, cpu.c, 0, "+")
 		cpu.a += cpu.c
 
 	case 0x82: // ADD A, D
-		cpu.modifyFlags(int(cpu.a)+int(cpu.d), "+")
+		cpu.modifyFlags(cpu.a, cpu.d, 0, "+")
 		cpu.a += cpu.d
 
 	case 0x83: // ADD A, E
-		cpu.modifyFlags(int(cpu.a)+int(cpu.e), "+")
+		cpu.modifyFlags(cpu.a, cpu.e, 0, "+")
 		cpu.a += cpu.e
 
 	case 0x84: // ADD A, H
-		cpu.modifyFlags(int(cpu.a)+int(cpu.h), "+")
+		cpu.modifyFlags(cpu.a, cpu.h, 0, "+")
 		cpu.a += cpu.h
 
 	case 0x85: // ADD A, L
-		cpu.modifyFlags(int(cpu.a)+int(cpu.l), "+")
+		cpu.modifyFlags(cpu.a, cpu.l, 0, "+")
 		cpu.a += cpu.l
 
 	case 0x86: // ADD A, [HL]
 		n := cpu.read(cpu.hl())
-		cpu.modifyFlags(int(cpu.a)+int(n), "+")
+		cpu.modifyFlags(cpu.a, n, 0, "+")
 		cpu.a += n
 
 	case 0x87: // ADD A, A
-		cpu.modifyFlags(int(cpu.a)+int(cpu.a), "+")
+		cpu.modifyFlags(cpu.a, cpu.a, 0, "+")
 		cpu.a += cpu.a
 
 	case 0x88: // ADC A, B
-		cpu.modifyFlags(int(cpu.a)+int(cpu.b)+int(cpu.getCarryFlag()), "+")
+		cpu.modifyFlags(cpu.a, cpu.b, cpu.getCarryFlag(), "+")
 		cpu.a += cpu.b + cpu.getCarryFlag()
 
 	case 0x89: // ADC A, C
-		cpu.modifyFlags(int(cpu.a)+int(cpu.c)+int(cpu.getCarryFlag()), "+")
+		cpu.modifyFlags(cpu.a, cpu.c, cpu.getCarryFlag(), "+")
 		cpu.a += cpu.c + cpu.getCarryFlag()
 
 	case 0x8A: // ADC A, D
-		cpu.modifyFlags(int(cpu.a)+int(cpu.d)+int(cpu.getCarryFlag()), "+")
+		cpu.modifyFlags(cpu.a, cpu.d, cpu.getCarryFlag(), "+")
 		cpu.a += cpu.d + cpu.getCarryFlag()
 
 	case 0x8B: // ADC A, E
-		cpu.modifyFlags(int(cpu.a)+int(cpu.e)+int(cpu.getCarryFlag()), "+")
+		cpu.modifyFlags(cpu.a, cpu.e, cpu.getCarryFlag(), "+")
 		cpu.a += cpu.e + cpu.getCarryFlag()
 
 	case 0x8C: // ADC A, H
-		cpu.modifyFlags(int(cpu.a)+int(cpu.h)+int(cpu.getCarryFlag()), "+")
+		cpu.modifyFlags(cpu.a, cpu.h, cpu.getCarryFlag(), "+")
 		cpu.a += cpu.h + cpu.getCarryFlag()
 
 	case 0x8D: // ADC A, L
-		cpu.modifyFlags(int(cpu.a)+int(cpu.l)+int(cpu.getCarryFlag()), "+")
+		cpu.modifyFlags(cpu.a, cpu.l, cpu.getCarryFlag(), "+")
 		cpu.a += cpu.l + cpu.getCarryFlag()
 
 	case 0x8E: // ADC A, [HL]
 		n := cpu.read(cpu.hl())
-		cpu.modifyFlags(int(cpu.a)+int(n)+int(cpu.getCarryFlag()), "+")
+		cpu.modifyFlags(cpu.a, n, cpu.getCarryFlag(), "+")
 		cpu.a += n + cpu.getCarryFlag()
 
 	case 0x8F: // ADC A, A
-		cpu.modifyFlags(int(cpu.a)+int(cpu.a)+int(cpu.getCarryFlag()), "+")
+		cpu.modifyFlags(cpu.a, cpu.a, cpu.getCarryFlag(), "+")
 		cpu.a += cpu.a + cpu.getCarryFlag()
 
 	case 0x90: // SUB B
-		cpu.modifyFlags(int(cpu.a)-int(cpu.b), "-")
+		cpu.modifyFlags(cpu.a, cpu.b, 0, "-")
 		cpu.a -= cpu.b
 
 	case 0x91: // SUB C
-		cpu.modifyFlags(int(cpu.a)-int(cpu.c), "-")
+		cpu.modifyFlags(cpu.a, cpu.c, 0, "-")
 		cpu.a -= cpu.c
 
 	case 0x92: // SUB D
-		cpu.modifyFlags(int(cpu.a)-int(cpu.d), "-")
+		cpu.modifyFlags(cpu.a, cpu.d, 0, "-")
 		cpu.a -= cpu.d
 
 	case 0x93: // SUB E
-		cpu.modifyFlags(int(cpu.a)-int(cpu.e), "-")
+		cpu.modifyFlags(cpu.a, cpu.e, 0, "-")
 		cpu.a -= cpu.e
 
 	case 0x94: // SUB H
-		cpu.modifyFlags(int(cpu.a)-int(cpu.h), "-")
+		cpu.modifyFlags(cpu.a, cpu.h, 0, "-")
 		cpu.a -= cpu.h
 
 	case 0x95: // SUB L
-		cpu.modifyFlags(int(cpu.a)-int(cpu.l), "-")
+		cpu.modifyFlags(cpu.a, cpu.l, 0, "-")
 		cpu.a -= cpu.l
 
 	case 0x96: // SUB [HL]
 		n := cpu.read(cpu.hl())
-		cpu.modifyFlags(int(cpu.a)-int(n), "-")
+		cpu.modifyFlags(cpu.a, n, 0, "-")
 		cpu.a -= n
 
 	case 0x97: // SUB A
-		cpu.modifyFlags(int(cpu.a)-int(cpu.a), "-")
+		cpu.modifyFlags(cpu.a, cpu.a, 0, "-")
 		cpu.a -= cpu.a
 
 	case 0x98: // SBC A, B
-		cpu.modifyFlags(int(cpu.a)-int(cpu.b)-int(cpu.getCarryFlag()), "-")
+		cpu.modifyFlags(cpu.a, cpu.b, cpu.getCarryFlag(), "-")
 		cpu.a -= cpu.b + cpu.getCarryFlag()
 
 	case 0x99: // SBC A, C
-		cpu.modifyFlags(int(cpu.a)-int(cpu.c)-int(cpu.getCarryFlag()), "-")
+		cpu.modifyFlags(cpu.a, cpu.c, cpu.getCarryFlag(), "-")
 		cpu.a -= cpu.c + cpu.getCarryFlag()
 
 	case 0x9A: // SBC A, D
-		cpu.modifyFlags(int(cpu.a)-int(cpu.d)-int(cpu.getCarryFlag()), "-")
+		cpu.modifyFlags(cpu.a, cpu.d, cpu.getCarryFlag(), "-")
 		cpu.a -= cpu.d + cpu.getCarryFlag()
 
 	case 0x9B: // SBC A, E
-		cpu.modifyFlags(int(cpu.a)-int(cpu.e)-int(cpu.getCarryFlag()), "-")
+		cpu.modifyFlags(cpu.a, cpu.e, cpu.getCarryFlag(), "-")
 		cpu.a -= cpu.e + cpu.getCarryFlag()
 
 	case 0x9C: // SBC A, H
-		cpu.modifyFlags(int(cpu.a)-int(cpu.h)-int(cpu.getCarryFlag()), "-")
+		cpu.modifyFlags(cpu.a, cpu.h, cpu.getCarryFlag(), "-")
 		cpu.a -= cpu.h + cpu.getCarryFlag()
 
 	case 0x9D: // SBC A, L
-		cpu.modifyFlags(int(cpu.a)-int(cpu.l)-int(cpu.getCarryFlag()), "-")
+		cpu.modifyFlags(cpu.a, cpu.l, cpu.getCarryFlag(), "-")
 		cpu.a -= cpu.l + cpu.getCarryFlag()
 
 	case 0x9E: // SBC A, [HL]
 		n := cpu.read(cpu.hl())
-		cpu.modifyFlags(int(cpu.a)-int(n)-int(cpu.getCarryFlag()), "-")
+		cpu.modifyFlags(cpu.a, n, cpu.getCarryFlag(), "-")
 		cpu.a -= n + cpu.getCarryFlag()
 
 	case 0x9F: // SBC A, A
-		cpu.modifyFlags(int(cpu.a)-int(cpu.a)-int(cpu.getCarryFlag()), "-")
+		cpu.modifyFlags(cpu.a, cpu.a, cpu.getCarryFlag(), "-")
 		cpu.a -= cpu.a + cpu.getCarryFlag()
 
 	case 0xA0: // AND B
@@ -798,7 +828,7 @@ func (cpu *CPU) decodeAndExecute(inst opcode, operands []uint8) {
 
 	case 0xC1: // POP BC
 		l := cpu.read(cpu.sp)
-		h := cpu.read(cpu.sp - 1)
+		h := cpu.read(cpu.sp + 1)
 		cpu.set_bc(u8tou16(l, h))
 		cpu.sp += 2
 
@@ -829,7 +859,7 @@ func (cpu *CPU) decodeAndExecute(inst opcode, operands []uint8) {
 
 	case 0xC6: // ADD A, n
 		n := operands[0]
-		cpu.modifyFlags(int(cpu.a)+int(n), "+")
+		cpu.modifyFlags(cpu.a, n, 0, "+")
 		cpu.a += n
 
 	case 0xC7: // RST 0x00
@@ -852,7 +882,7 @@ func (cpu *CPU) decodeAndExecute(inst opcode, operands []uint8) {
 		}
 
 	case 0xCB: // PREFIX CB
-		cpu.executeCBInst()
+		cpu.cycle = cpu.executeCBInst()
 
 	case 0xCC: // CALL Z, nn
 		lsb := operands[0]
@@ -871,7 +901,7 @@ func (cpu *CPU) decodeAndExecute(inst opcode, operands []uint8) {
 
 	case 0xCE: // ADC A, n
 		n := operands[0]
-		cpu.modifyFlags(int(cpu.a)+int(n)+int(cpu.getCarryFlag()), "+")
+		cpu.modifyFlags(cpu.a, n, cpu.getCarryFlag(), "+")
 		cpu.a += n + cpu.getCarryFlag()
 
 	case 0xCF: // RST 0x08
@@ -885,7 +915,7 @@ func (cpu *CPU) decodeAndExecute(inst opcode, operands []uint8) {
 
 	case 0xD1: // POP DE
 		l := cpu.read(cpu.sp)
-		h := cpu.read(cpu.sp - 1)
+		h := cpu.read(cpu.sp + 1)
 		cpu.set_de(u8tou16(l, h))
 		cpu.sp += 2
 
@@ -914,7 +944,7 @@ func (cpu *CPU) decodeAndExecute(inst opcode, operands []uint8) {
 
 	case 0xD6: // SUB n
 		n := operands[0]
-		cpu.modifyFlags(int(cpu.a)-int(n), "-")
+		cpu.modifyFlags(cpu.a, n, 0, "-")
 		cpu.a -= n
 
 	case 0xD7: // RST 0x10
@@ -928,7 +958,7 @@ func (cpu *CPU) decodeAndExecute(inst opcode, operands []uint8) {
 
 	case 0xD9: // RETI
 		cpu.popPreservedPC()
-		interrupt.SetIMEFlag()
+		cpu.irq.SetIMEFlag()
 
 	case 0xDA: // JP C, nn
 		lsb := operands[0]
@@ -953,7 +983,7 @@ func (cpu *CPU) decodeAndExecute(inst opcode, operands []uint8) {
 
 	case 0xDE: // SBC A, n
 		n := operands[0]
-		cpu.modifyFlags(int(cpu.a)-int(n)-int(cpu.getCarryFlag()), "-")
+		cpu.modifyFlags(cpu.a, n, cpu.getCarryFlag(), "-")
 		cpu.a -= n + cpu.getCarryFlag()
 
 	case 0xDF: // RST 0x18
@@ -966,7 +996,7 @@ func (cpu *CPU) decodeAndExecute(inst opcode, operands []uint8) {
 
 	case 0xE1: // POP HL
 		l := cpu.read(cpu.sp)
-		h := cpu.read(cpu.sp - 1)
+		h := cpu.read(cpu.sp + 1)
 		cpu.set_hl(u8tou16(l, h))
 		cpu.sp += 2
 
@@ -1027,7 +1057,7 @@ func (cpu *CPU) decodeAndExecute(inst opcode, operands []uint8) {
 
 	case 0xF1: // POP AF
 		l := cpu.read(cpu.sp)
-		h := cpu.read(cpu.sp - 1)
+		h := cpu.read(cpu.sp + 1)
 		cpu.set_af(u8tou16(l, h))
 		cpu.sp += 2
 
@@ -1036,7 +1066,7 @@ func (cpu *CPU) decodeAndExecute(inst opcode, operands []uint8) {
 		cpu.a = cpu.read(addr)
 
 	case 0xF3: // DI
-		interrupt.ClearIMEFlag()
+		cpu.irq.ClearIMEFlag()
 
 	case 0xF4: // EMPTY
 		invalidInst()
@@ -1064,7 +1094,7 @@ func (cpu *CPU) decodeAndExecute(inst opcode, operands []uint8) {
 		cpu.a = cpu.read(u8tou16(lsb, msb))
 
 	case 0xFB: // EI
-		interrupt.SetIMEFlag()
+		cpu.irq.SetIMEFlag()
 
 	case 0xFC: // EMPTY
 		invalidInst()
@@ -1081,6 +1111,7 @@ func (cpu *CPU) decodeAndExecute(inst opcode, operands []uint8) {
 		cpu.pc = 0x0038
 
 	case 0x10: // STOP
+		cpu.stop()
 
 	case 0x27: // DAA
 		// Decimal adjust register A.
@@ -1096,45 +1127,55 @@ func (cpu *CPU) decodeAndExecute(inst opcode, operands []uint8) {
 		cpu.clearHalfCarryFlag()
 
 	case 0x76: // HALT
-		if interrupt.IME {
-			// (IE & IF & 1F) != 0 となるまで、CPUは停止される
-		} else {
-
-		}
+		// IMEが'0'でも割り込みが要求されると再開し、ハンドラには飛ばない
+		cpu.halted = true
 
-	case 0xE8: // ADD SP, r - PENDING
-		r := operands[0]
-		cpu.clearZeroFlag()
-		cpu.clearSubFlag()
+	case 0xE8: // ADD SP, r
+		cpu.sp = cpu.addSPOffset(operands[0])
 
-		cpu.sp += uint16(int16(r))
-
-	case 0xF8: // LD HL, SP+r8 - PENDING
+	case 0xF8: // LD HL, SP+r8
+		cpu.set_hl(cpu.addSPOffset(operands[0]))
 	}
 }
 
 func (cpu *CPU) read(addr uint16) uint8 {
-	return memory.Read(addr)
+	val := cpu.mem.Read(addr)
+	if cpu.Watch != nil {
+		cpu.Watch(addr, val, false)
+	}
+	return val
 }
 
 func (cpu *CPU) write(addr uint16, val uint8) {
-	memory.Write(addr, val)
+	if cpu.Watch != nil {
+		cpu.Watch(addr, val, true)
+	}
+	cpu.mem.Write(addr, val)
+}
+
+// PC returns the address of the next instruction.
+func (cpu *CPU) PC() uint16 {
+	return cpu.pc
+}
+
+func (cpu *CPU) SP() uint16 {
+	return cpu.sp
 }
 
 func (cpu *CPU) af() uint16 {
-	return u8tou16(cpu.a, cpu.f)
+	return u8tou16(cpu.f, cpu.a)
 }
 
 func (cpu *CPU) bc() uint16 {
-	return u8tou16(cpu.b, cpu.c)
+	return u8tou16(cpu.c, cpu.b)
 }
 
 func (cpu *CPU) de() uint16 {
-	return u8tou16(cpu.d, cpu.e)
+	return u8tou16(cpu.e, cpu.d)
 }
 
 func (cpu *CPU) hl() uint16 {
-	return u8tou16(cpu.h, cpu.l)
+	return u8tou16(cpu.l, cpu.h)
 }
 
 func (cpu *CPU) setA(val uint8) {
@@ -1163,7 +1204,8 @@ func (cpu *CPU) setL(val uint8) {
 
 func (cpu *CPU) set_af(val uint16) {
 	cpu.a = msb(val)
-	cpu.f = lsb(val)
+	// the lower 4 bits of F are always 0
+	cpu.f = lsb(val) & 0xF0
 }
 
 func (cpu *CPU) set_bc(val uint16) {
@@ -1192,7 +1234,7 @@ func msb(bytes uint16) uint8 {
 
 // Least Significant Byte
 func lsb(bytes uint16) uint8 {
-	return uint8(bytes & 0x0F)
+	return uint8(bytes & 0xFF)
 }
 
 // little endian
@@ -1201,19 +1243,19 @@ func u8tou16(u8, v8 uint8) uint16 {
 }
 
 func (cpu *CPU) isZeroFlag() bool {
-	return cpu.f&0x80 == 1
+	return cpu.f&0x80 != 0
 }
 
 func (cpu *CPU) isSubFlag() bool {
-	return cpu.f&0x40 == 1
+	return cpu.f&0x40 != 0
 }
 
 func (cpu *CPU) isHalfCarryFlag() bool {
-	return cpu.f&0x20 == 1
+	return cpu.f&0x20 != 0
 }
 
 func (cpu *CPU) isCarryFlag() bool {
-	return cpu.f&0x10 == 1
+	return cpu.f&0x10 != 0
 }
 
 func (cpu *CPU) setZeroFlag() {
@@ -1260,6 +1302,20 @@ func (cpu *CPU) PushCurrentPC() {
 	cpu.write(cpu.sp, lsb(cpu.pc))
 }
 
+// Interrupt pushes PC and jumps to the handler at vector, which also
+// wakes up a halted CPU. It returns the 5 machine cycles it takes.
+func (cpu *CPU) Interrupt(vector uint16) int {
+	cpu.halted = false
+	cpu.PushCurrentPC()
+	cpu.pc = vector
+	return 5
+}
+
+// Halted is true from HALT until an interrupt is pending.
+func (cpu *CPU) Halted() bool {
+	return cpu.halted
+}
+
 func (cpu *CPU) popPreservedPC() {
 	lsb := cpu.read(cpu.sp)
 	cpu.sp++
@@ -1328,48 +1384,87 @@ func (cpu *CPU) modifyFlagsInIncOP(res uint8, op string) {
 		cpu.clearZeroFlag()
 	}
 
-	if res > 0x0F {
+	// INCは下位4bitが0に、DECはFになったときに4bit目との間で桁が動く
+	if op == "INC" && res&0x0F == 0x00 || op == "DEC" && res&0x0F == 0x0F {
 		cpu.setHalfCarryFlag()
 	} else {
 		cpu.clearHalfCarryFlag()
 	}
 }
 
-func (cpu *CPU) modifyFlagsAddHL(val int) {
+// - 0 H C
+func (cpu *CPU) modifyFlagsAddHL(hl, val uint16) {
 	cpu.clearSubFlag()
 
-	if val <= 0xFFF {
+	// Hはbit 11から、Cはbit 15からの桁上がり
+	if (hl&0x0FFF)+(val&0x0FFF) > 0x0FFF {
+		cpu.setHalfCarryFlag()
+	} else {
 		cpu.clearHalfCarryFlag()
+	}
+
+	if uint32(hl)+uint32(val) > 0xFFFF {
+		cpu.setCarryFlag()
+	} else {
 		cpu.clearCarryFlag()
-	} else if 0xFFF < val && val <= 0xFFFF {
+	}
+}
+
+// 0 0 H C
+// SP + r for ADD SP, r and LD HL, SP+r8.
+func (cpu *CPU) addSPOffset(r uint8) uint16 {
+	cpu.clearZeroFlag()
+	cpu.clearSubFlag()
+
+	// rが負の値でも、HとCはSPの下位8bitとrを符号なしで足したときの桁上がり
+	lo := uint8(cpu.sp)
+	if (lo&0x0F)+(r&0x0F) > 0x0F {
 		cpu.setHalfCarryFlag()
-		cpu.clearCarryFlag()
 	} else {
-		cpu.setHalfCarryFlag()
+		cpu.clearHalfCarryFlag()
+	}
+
+	if uint16(lo)+uint16(r) > 0xFF {
 		cpu.setCarryFlag()
+	} else {
+		cpu.clearCarryFlag()
 	}
+	return cpu.sp + uint16(int8(r))
 }
 
-func (cpu *CPU) modifyFlags(res int, op string) {
+// Z N H C of a + b + carry or a - b - carry, carry is 0 for ADD and SUB.
+func (cpu *CPU) modifyFlags(a, b, carry uint8, op string) {
+	// resは8bitに収まる前の値
+	var res int
+	// 下位4bitからの桁上がり、または下位4bitへの桁借り
+	var half bool
 	switch op {
 	case "+":
 		cpu.clearSubFlag()
+		res = int(a) + int(b) + int(carry)
+		half = (a&0x0F)+(b&0x0F)+carry > 0x0F
 	case "-":
 		cpu.setSubFlag()
+		res = int(a) - int(b) - int(carry)
+		half = (a & 0x0F) < (b&0x0F)+carry
 	}
 
-	if res == 0 {
+	if uint8(res) == 0 {
 		cpu.setZeroFlag()
-		cpu.clearHalfCarryFlag()
-		cpu.clearCarryFlag()
-	} else if 0x0F < res && res <= 0xFF {
+	} else {
 		cpu.clearZeroFlag()
-		cpu.setHalfCarryFlag()
+	}
+
+	if res < 0 || 0xFF < res {
+		cpu.setCarryFlag()
+	} else {
 		cpu.clearCarryFlag()
-	} else if 0xFF < res {
-		cpu.clearZeroFlag()
+	}
+
+	if half {
+		cpu.setHalfCarryFlag()
+	} else {
 		cpu.clearHalfCarryFlag()
-		cpu.setCarryFlag()
 	}
 }
 
@@ -1392,15 +1487,12 @@ func (cpu *CPU) rlca() {
 	cpu.a = lShifted
 }
 
-// 最下位ビットが立っていたら、桁あふれした1を最下位ビットにつける
+// Carry Flagを最下位ビットに、Aの最上位ビットをCarry Flagに移す
 func (cpu *CPU) rla() {
-	lShifted := cpu.a << 1
+	lShifted := cpu.a<<1 | cpu.getCarryFlag()
 
 	// Aの最上位ビットが1の場合
 	if cpu.a&0x80 == 0x80 {
-		if cpu.isCarryFlag() {
-			lShifted ^= 0x01
-		}
 		cpu.setCarryFlag()
 
 		// Aの最上位ビットが0の場合
@@ -1434,13 +1526,10 @@ func (cpu *CPU) rrca() {
 }
 
 func (cpu *CPU) rra() {
-	rShifted := cpu.a >> 1
+	rShifted := cpu.a>>1 | cpu.getCarryFlag()<<7
 
 	// Aの最下位ビットが1の場合
 	if cpu.a&0x01 == 0x01 {
-		if cpu.isCarryFlag() {
-			rShifted ^= 0x80
-		}
 		cpu.setCarryFlag()
 
 		// Aの最下位ビットが0の場合
@@ -1454,8 +1543,138 @@ func (cpu *CPU) rra() {
 	cpu.a = rShifted
 }
 
-func (cpu *CPU) executeCBInst() {
+// CB prefixed instructions
+//
+//	xx000rrr: RLC, RRC, RL, RR, SLA, SRA, SWAP, SRL (xx=00, 000=operation)
+//	01bbbrrr: BIT b, r
+//	10bbbrrr: RES b, r
+//	11bbbrrr: SET b, r
+//
+// r is B, C, D, E, H, L, [HL], A in this order.
+// Returns the machine cycles including the prefix.
+func (cpu *CPU) executeCBInst() int {
+	op := cpu.read(cpu.pc)
+	cpu.pc++
+
+	r := op & 0x07
+	b := (op >> 3) & 0x07
+	val := cpu.getCBOperand(r)
+
+	switch op >> 6 {
+	case 0:
+		cpu.setCBOperand(r, cpu.shiftCB(b, val))
+
+	case 1: // BIT
+		if val&(1<<b) == 0 {
+			cpu.setZeroFlag()
+		} else {
+			cpu.clearZeroFlag()
+		}
+		cpu.clearSubFlag()
+		cpu.setHalfCarryFlag()
+		if r == 6 {
+			return 3
+		}
+		return 2
+
+	case 2: // RES
+		cpu.setCBOperand(r, val&^(1<<b))
+
+	case 3: // SET
+		cpu.setCBOperand(r, val|(1<<b))
+	}
+
+	if r == 6 {
+		return 4
+	}
+	return 2
+}
+
+// Z 0 0 C
+func (cpu *CPU) shiftCB(kind uint8, val uint8) uint8 {
+	var res uint8
+	var carry bool
+
+	switch kind {
+	case 0: // RLC
+		res = val<<1 | val>>7
+		carry = val&0x80 != 0
+	case 1: // RRC
+		res = val>>1 | val<<7
+		carry = val&0x01 != 0
+	case 2: // RL
+		res = val<<1 | cpu.getCarryFlag()
+		carry = val&0x80 != 0
+	case 3: // RR
+		res = val>>1 | cpu.getCarryFlag()<<7
+		carry = val&0x01 != 0
+	case 4: // SLA
+		res = val << 1
+		carry = val&0x80 != 0
+	case 5: // SRA
+		res = val>>1 | val&0x80
+		carry = val&0x01 != 0
+	case 6: // SWAP
+		res = val<<4 | val>>4
+	case 7: // SRL
+		res = val >> 1
+		carry = val&0x01 != 0
+	}
 
+	if res == 0 {
+		cpu.setZeroFlag()
+	} else {
+		cpu.clearZeroFlag()
+	}
+	cpu.clearSubFlag()
+	cpu.clearHalfCarryFlag()
+	if carry {
+		cpu.setCarryFlag()
+	} else {
+		cpu.clearCarryFlag()
+	}
+	return res
+}
+
+func (cpu *CPU) getCBOperand(r uint8) uint8 {
+	switch r {
+	case 0:
+		return cpu.b
+	case 1:
+		return cpu.c
+	case 2:
+		return cpu.d
+	case 3:
+		return cpu.e
+	case 4:
+		return cpu.h
+	case 5:
+		return cpu.l
+	case 6:
+		return cpu.read(cpu.hl())
+	}
+	return cpu.a
+}
+
+func (cpu *CPU) setCBOperand(r uint8, val uint8) {
+	switch r {
+	case 0:
+		cpu.b = val
+	case 1:
+		cpu.c = val
+	case 2:
+		cpu.d = val
+	case 3:
+		cpu.e = val
+	case 4:
+		cpu.h = val
+	case 5:
+		cpu.l = val
+	case 6:
+		cpu.write(cpu.hl(), val)
+	default:
+		cpu.a = val
+	}
 }
 
 func invalidInst() {
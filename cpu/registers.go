@@ -0,0 +1,112 @@
+package cpu
+
+import (
+	"fmt"
+)
+
+// Registers is a copy of the CPU registers for tools outside this package.
+type Registers struct {
+	A, F, B, C, D, E, H, L uint8
+
+	SP uint16
+	PC uint16
+}
+
+// Get returns the current registers.
+func (cpu *CPU) Get() Registers {
+	return Registers{
+		A:  cpu.a,
+		F:  cpu.f,
+		B:  cpu.b,
+		C:  cpu.c,
+		D:  cpu.d,
+		E:  cpu.e,
+		H:  cpu.h,
+		L:  cpu.l,
+		SP: cpu.sp,
+		PC: cpu.pc,
+	}
+}
+
+// Set overwrites every register.
+// The lower 4 bits of F are always 0.
+func (cpu *CPU) Set(r Registers) {
+	cpu.a = r.A
+	cpu.f = r.F & 0xF0
+	cpu.b = r.B
+	cpu.c = r.C
+	cpu.d = r.D
+	cpu.e = r.E
+	cpu.h = r.H
+	cpu.l = r.L
+	cpu.sp = r.SP
+	cpu.pc = r.PC
+}
+
+func (r Registers) AF() uint16 {
+	return u8tou16(r.F, r.A)
+}
+
+func (r Registers) BC() uint16 {
+	return u8tou16(r.C, r.B)
+}
+
+func (r Registers) DE() uint16 {
+	return u8tou16(r.E, r.D)
+}
+
+func (r Registers) HL() uint16 {
+	return u8tou16(r.L, r.H)
+}
+
+// Flag register
+//  Bit 7 - Zero Flag
+//  Bit 6 - Subtract Flag
+//  Bit 5 - Half Carry Flag
+//  Bit 4 - Carry Flag
+
+func (r Registers) ZeroFlag() bool {
+	return r.F&0x80 != 0
+}
+
+func (r Registers) SubFlag() bool {
+	return r.F&0x40 != 0
+}
+
+func (r Registers) HalfCarryFlag() bool {
+	return r.F&0x20 != 0
+}
+
+func (r Registers) CarryFlag() bool {
+	return r.F&0x10 != 0
+}
+
+func (r *Registers) SetZeroFlag(on bool) {
+	r.setFlag(0x80, on)
+}
+
+func (r *Registers) SetSubFlag(on bool) {
+	r.setFlag(0x40, on)
+}
+
+func (r *Registers) SetHalfCarryFlag(on bool) {
+	r.setFlag(0x20, on)
+}
+
+func (r *Registers) SetCarryFlag(on bool) {
+	r.setFlag(0x10, on)
+}
+
+func (r *Registers) setFlag(mask uint8, on bool) {
+	if on {
+		r.F |= mask
+	} else {
+		r.F &^= mask
+	}
+}
+
+// String formats the registers like "AF=01B0 BC=0013 DE=00D8 HL=014D SP=FFFE PC=0100".
+func (r Registers) String() string {
+	return fmt.Sprintf("AF=%04X BC=%04X DE=%04X HL=%04X SP=%04X PC=%04X",
+		r.AF(), r.BC(), r.DE(), r.HL(), r.SP, r.PC)
+}
@@ -0,0 +1,38 @@
+package cpu
+
+// FF4D - KEY1 - CGB Mode Only - Prepare Speed Switch
+//  Bit 7: Current Speed     (0=Normal, 1=Double) (Read Only)
+//  Bit 0: Prepare Speed Switch (0=No, 1=Prepare) (Read/Write)
+// The speed is switched by executing STOP after setting Bit 0.
+const KEY1 = 0xFF4D
+
+// EnableCGB maps KEY1 so that the game can switch to double speed.
+func (cpu *CPU) EnableCGB() {
+	cpu.mem.HandleRead(KEY1, cpu.readKEY1)
+	cpu.mem.HandleWrite(KEY1, func(val uint8) {
+		cpu.prepareSpeedSwitch = val&0x01 != 0
+	})
+}
+
+func (cpu *CPU) readKEY1() uint8 {
+	val := uint8(0x7E)
+	if cpu.doubleSpeed {
+		val |= 0x80
+	}
+	if cpu.prepareSpeedSwitch {
+		val |= 0x01
+	}
+	return val
+}
+
+// DoubleSpeed is true when the CPU runs at 8.388608MHz.
+func (cpu *CPU) DoubleSpeed() bool {
+	return cpu.doubleSpeed
+}
+
+func (cpu *CPU) stop() {
+	if cpu.prepareSpeedSwitch {
+		cpu.doubleSpeed = !cpu.doubleSpeed
+		cpu.prepareSpeedSwitch = false
+	}
+}
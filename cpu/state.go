@@ -0,0 +1,28 @@
+package cpu
+
+// State is what a save state keeps of the CPU.
+type State struct {
+	Registers
+	Cycle              int64
+	DoubleSpeed        bool
+	PrepareSpeedSwitch bool
+	Halted             bool
+}
+
+func (cpu *CPU) State() State {
+	return State{
+		Registers:          cpu.Get(),
+		Cycle:              int64(cpu.cycle),
+		DoubleSpeed:        cpu.doubleSpeed,
+		PrepareSpeedSwitch: cpu.prepareSpeedSwitch,
+		Halted:             cpu.halted,
+	}
+}
+
+func (cpu *CPU) SetState(s State) {
+	cpu.Set(s.Registers)
+	cpu.cycle = int(s.Cycle)
+	cpu.doubleSpeed = s.DoubleSpeed
+	cpu.prepareSpeedSwitch = s.PrepareSpeedSwitch
+	cpu.halted = s.Halted
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"tgb/debug"
+	"tgb/gb"
+	"tgb/model"
+)
+
+func debugCommand(args []string) error {
+	fs := flag.NewFlagSet("debug", flag.ExitOnError)
+	headless := fs.Bool("headless", false, "run without a window")
+	modelName := fs.String("model", "auto", "hardware model: auto, dmg0, dmg, mgb, sgb, cgb or agb")
+	symPath := fs.String("sym", "", "symbol file, <rom>.sym is loaded if it exists")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("debug: expected exactly one ROM")
+	}
+
+	m, err := model.Parse(*modelName)
+	if err != nil {
+		return err
+	}
+
+	gb, err := gb.New(fs.Arg(0), gb.Config{
+		Headless: *headless,
+		Model:    m,
+	})
+	if err != nil {
+		return err
+	}
+	if err := gb.Boot(); err != nil {
+		return err
+	}
+
+	syms, labels, err := loadSymbols(*symPath, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	d := debug.New(gb)
+	d.Symbols = syms
+	d.Labels = labels
+	return d.REPL(os.Stdin, os.Stdout)
+}
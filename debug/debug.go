@@ -0,0 +1,239 @@
+package debug
+
+import (
+	"fmt"
+	"tgb/disasm"
+	"tgb/gb"
+)
+
+// Watchpoint stops the execution when the CPU accesses Addr.
+type Watchpoint struct {
+	Addr  uint16
+	Read  bool
+	Write bool
+	// Only stop when the value read or written is Value.
+	HasValue bool
+	Value    uint8
+}
+
+func (w Watchpoint) String() string {
+	mode := ""
+	if w.Read {
+		mode += "r"
+	}
+	if w.Write {
+		mode += "w"
+	}
+	s := fmt.Sprintf("%04X %s", w.Addr, mode)
+	if w.HasValue {
+		s += fmt.Sprintf(" =%02X", w.Value)
+	}
+	return s
+}
+
+// Stop tells why the execution stopped.
+type Stop struct {
+	Reason string
+	PC     uint16
+}
+
+func (s Stop) String() string {
+	return fmt.Sprintf("%s at %04X", s.Reason, s.PC)
+}
+
+// Debugger runs a GB instruction by instruction and stops
+// at breakpoints and watchpoints.
+type Debugger struct {
+	GB *gb.GB
+	// Names shown instead of the addresses
+	Symbols disasm.Symbols
+	// Names accepted as addresses
+	Labels disasm.Labels
+
+	breakpoints map[uint16]bool
+	watchpoints []Watchpoint
+
+	// set by the watch hook while an instruction runs
+	hit      *Watchpoint
+	hitValue uint8
+	hitWrite bool
+}
+
+// New attaches a debugger to g. g has to be booted already.
+func New(g *gb.GB) *Debugger {
+	d := &Debugger{
+		GB:          g,
+		breakpoints: map[uint16]bool{},
+	}
+	return d
+}
+
+func (d *Debugger) AddBreakpoint(addr uint16) {
+	d.breakpoints[addr] = true
+}
+
+func (d *Debugger) RemoveBreakpoint(addr uint16) {
+	delete(d.breakpoints, addr)
+}
+
+func (d *Debugger) Breakpoints() []uint16 {
+	var addrs []uint16
+	for addr := range d.breakpoints {
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
+
+func (d *Debugger) AddWatchpoint(w Watchpoint) {
+	d.watchpoints = append(d.watchpoints, w)
+}
+
+// RemoveWatchpoint removes every watchpoint on addr.
+func (d *Debugger) RemoveWatchpoint(addr uint16) {
+	ws := d.watchpoints[:0]
+	for _, w := range d.watchpoints {
+		if w.Addr != addr {
+			ws = append(ws, w)
+		}
+	}
+	d.watchpoints = ws
+}
+
+func (d *Debugger) Watchpoints() []Watchpoint {
+	return d.watchpoints
+}
+
+func (d *Debugger) watch(addr uint16, val uint8, write bool) {
+	if d.hit != nil {
+		return
+	}
+	for i, w := range d.watchpoints {
+		if w.Addr != addr || (write && !w.Write) || (!write && !w.Read) {
+			continue
+		}
+		if w.HasValue && w.Value != val {
+			continue
+		}
+		d.hit = &d.watchpoints[i]
+		d.hitValue = val
+		d.hitWrite = write
+		return
+	}
+}
+
+func (d *Debugger) pc() uint16 {
+	return d.GB.CPU.PC()
+}
+
+// step executes one instruction. It returns a Stop when
+// a watchpoint was hit or the emulator is done.
+func (d *Debugger) step() *Stop {
+	// Boot() may have replaced the CPU since the last step.
+	d.GB.CPU.Watch = d.watch
+	d.hit = nil
+
+	pc := d.pc()
+	d.GB.Step()
+
+	if d.hit != nil {
+		access := "read"
+		if d.hitWrite {
+			access = "write"
+		}
+		return &Stop{
+			Reason: fmt.Sprintf("watchpoint %s (%s %02X)", d.hit, access, d.hitValue),
+			PC:     pc,
+		}
+	}
+	if d.GB.Done() {
+		return &Stop{Reason: "emulation ended", PC: d.pc()}
+	}
+	return nil
+}
+
+// Step executes one instruction.
+func (d *Debugger) Step() Stop {
+	if stop := d.step(); stop != nil {
+		return *stop
+	}
+	return Stop{Reason: "step", PC: d.pc()}
+}
+
+// Continue runs until a breakpoint or a watchpoint is hit.
+func (d *Debugger) Continue() Stop {
+	return d.runUntil(func() bool { return false })
+}
+
+// RunTo runs until PC reaches addr, like a breakpoint used only once.
+func (d *Debugger) RunTo(addr uint16) Stop {
+	return d.runUntil(func() bool { return d.pc() == addr })
+}
+
+// StepOver executes a CALL or RST and everything it calls as one step.
+func (d *Debugger) StepOver() Stop {
+	op := d.GB.Memory.Read(d.pc())
+	if !isCall(op) {
+		return d.Step()
+	}
+	next := d.pc() + uint16(1+callOperandLength(op))
+	sp := d.GB.CPU.SP()
+	// SP is checked so that a recursive call doesn't stop too early.
+	return d.runUntil(func() bool { return d.pc() == next && d.GB.CPU.SP() >= sp })
+}
+
+// StepOut runs until the current function returns.
+func (d *Debugger) StepOut() Stop {
+	sp := d.GB.CPU.SP()
+	var ret bool
+	return d.runUntil(func() bool {
+		// The check runs after each step: the last instruction
+		// was a return if SP went above where it was.
+		done := ret && d.GB.CPU.SP() > sp
+		ret = isReturn(d.GB.Memory.Read(d.pc()))
+		return done
+	})
+}
+
+// runUntil steps until done returns true or a breakpoint or a watchpoint is hit.
+// The instruction at the current PC is executed even if it has a breakpoint.
+// done is also called once before the first step, so that it can
+// look at the first instruction.
+func (d *Debugger) runUntil(done func() bool) Stop {
+	done()
+	for {
+		if stop := d.step(); stop != nil {
+			return *stop
+		}
+		if done() {
+			return Stop{Reason: "stopped", PC: d.pc()}
+		}
+		if d.breakpoints[d.pc()] {
+			return Stop{Reason: "breakpoint", PC: d.pc()}
+		}
+	}
+}
+
+// CALL nn, CALL cc,nn and RST n
+func isCall(op uint8) bool {
+	switch op {
+	case 0xCD, 0xC4, 0xCC, 0xD4, 0xDC:
+		return true
+	}
+	return op&0xC7 == 0xC7
+}
+
+func callOperandLength(op uint8) int {
+	if op&0xC7 == 0xC7 {
+		return 0
+	}
+	return 2
+}
+
+// RET, RETI and RET cc
+func isReturn(op uint8) bool {
+	switch op {
+	case 0xC9, 0xD9, 0xC0, 0xC8, 0xD0, 0xD8:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,237 @@
+package debug
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"tgb/disasm"
+)
+
+const help = `commands:
+  s, step              execute one instruction
+  n, next              step over CALL and RST
+  f, finish            run until the current function returns
+  c, continue          run until a breakpoint or a watchpoint
+  u, until ADDR        run to ADDR
+  b, break ADDR        set a breakpoint
+  w, watch ADDR [r|w|rw] [=VAL]
+                       stop when the CPU reads and/or writes (default) ADDR,
+                       only when the value is VAL if given
+  d, delete ADDR       delete the breakpoints and watchpoints on ADDR
+  l, list              list the breakpoints and watchpoints
+  r, regs              print the registers and the flags
+  x ADDR [N]           print N bytes of memory from ADDR
+  q, quit              quit
+An empty line repeats the last command. Numbers are hexadecimal,
+an ADDR can also be the name of a symbol.
+`
+
+var errQuit = errors.New("quit")
+
+// REPL reads commands from in until "quit" or EOF.
+func (d *Debugger) REPL(in io.Reader, out io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	last := ""
+	d.printLocation(out)
+	for {
+		fmt.Fprint(out, "(tgb) ")
+		if !scanner.Scan() {
+			return scanner.Err()
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			line = last
+		}
+		last = line
+		if line == "" {
+			continue
+		}
+
+		err := d.execute(strings.Fields(line), out)
+		if err == errQuit {
+			return nil
+		}
+		if err != nil {
+			fmt.Fprintln(out, err)
+		}
+	}
+}
+
+func (d *Debugger) execute(args []string, out io.Writer) error {
+	var stop *Stop
+	run := func(s Stop) { stop = &s }
+
+	switch args[0] {
+	case "s", "step":
+		run(d.Step())
+	case "n", "next":
+		run(d.StepOver())
+	case "f", "finish":
+		run(d.StepOut())
+	case "c", "continue":
+		run(d.Continue())
+	case "u", "until":
+		addr, err := d.argAddr(args, 1)
+		if err != nil {
+			return err
+		}
+		run(d.RunTo(addr))
+	case "b", "break":
+		addr, err := d.argAddr(args, 1)
+		if err != nil {
+			return err
+		}
+		d.AddBreakpoint(addr)
+	case "w", "watch":
+		w, err := d.parseWatchpoint(args[1:])
+		if err != nil {
+			return err
+		}
+		d.AddWatchpoint(w)
+	case "d", "delete":
+		addr, err := d.argAddr(args, 1)
+		if err != nil {
+			return err
+		}
+		d.RemoveBreakpoint(addr)
+		d.RemoveWatchpoint(addr)
+	case "l", "list":
+		d.printPoints(out)
+	case "r", "regs":
+		d.printRegisters(out)
+	case "x":
+		return d.examine(args, out)
+	case "q", "quit":
+		return errQuit
+	case "h", "help":
+		fmt.Fprint(out, help)
+	default:
+		return fmt.Errorf("unknown command %q, try \"help\"", args[0])
+	}
+
+	if stop != nil {
+		if stop.Reason != "step" && stop.Reason != "stopped" {
+			fmt.Fprintln(out, stop)
+		}
+		d.printLocation(out)
+	}
+	return nil
+}
+
+func (d *Debugger) printLocation(out io.Writer) {
+	in := disasm.Decode(d.GB.Memory.Read, d.pc())
+	if name, ok := d.Symbols[in.Addr]; ok {
+		fmt.Fprintf(out, "%s:\n", name)
+	}
+	fmt.Fprintf(out, "PC=%04X SP=%04X  %-9s %s\n", in.Addr, d.GB.CPU.SP(), in.Hex(), in.Text(d.Symbols))
+}
+
+func (d *Debugger) printRegisters(out io.Writer) {
+	r := d.GB.CPU.Get()
+	flag := func(set bool, c string) string {
+		if set {
+			return c
+		}
+		return "-"
+	}
+	fmt.Fprintf(out, "%s  %s%s%s%s\n", r,
+		flag(r.ZeroFlag(), "Z"), flag(r.SubFlag(), "N"),
+		flag(r.HalfCarryFlag(), "H"), flag(r.CarryFlag(), "C"))
+}
+
+func (d *Debugger) printPoints(out io.Writer) {
+	bps := d.Breakpoints()
+	sort.Slice(bps, func(i, j int) bool { return bps[i] < bps[j] })
+	for _, addr := range bps {
+		fmt.Fprintf(out, "break %04X%s\n", addr, d.symbolSuffix(addr))
+	}
+	for _, w := range d.Watchpoints() {
+		fmt.Fprintf(out, "watch %s%s\n", w, d.symbolSuffix(w.Addr))
+	}
+}
+
+// symbolSuffix returns " (name)" if addr has a symbol.
+func (d *Debugger) symbolSuffix(addr uint16) string {
+	if name, ok := d.Symbols[addr]; ok {
+		return " (" + name + ")"
+	}
+	return ""
+}
+
+func (d *Debugger) examine(args []string, out io.Writer) error {
+	addr, err := d.argAddr(args, 1)
+	if err != nil {
+		return err
+	}
+	n := 16
+	if len(args) > 2 {
+		v, err := strconv.ParseUint(args[2], 16, 16)
+		if err != nil {
+			return err
+		}
+		n = int(v)
+	}
+
+	for i := 0; i < n; i++ {
+		a := addr + uint16(i)
+		if i%16 == 0 {
+			if i > 0 {
+				fmt.Fprintln(out)
+			}
+			fmt.Fprintf(out, "%04X:", a)
+		}
+		fmt.Fprintf(out, " %02X", d.GB.Memory.Read(a))
+	}
+	fmt.Fprintln(out)
+	return nil
+}
+
+// parseWatchpoint parses "ADDR [r|w|rw] [=VAL]".
+func (d *Debugger) parseWatchpoint(args []string) (Watchpoint, error) {
+	addr, err := d.argAddr(append([]string{"watch"}, args...), 1)
+	if err != nil {
+		return Watchpoint{}, err
+	}
+	w := Watchpoint{Addr: addr, Write: true}
+
+	for _, arg := range args[1:] {
+		switch {
+		case arg == "r":
+			w.Read, w.Write = true, false
+		case arg == "w":
+			w.Read, w.Write = false, true
+		case arg == "rw":
+			w.Read, w.Write = true, true
+		case strings.HasPrefix(arg, "="):
+			v, err := strconv.ParseUint(strings.TrimPrefix(arg[1:], "$"), 16, 8)
+			if err != nil {
+				return Watchpoint{}, err
+			}
+			w.HasValue, w.Value = true, uint8(v)
+		default:
+			return Watchpoint{}, fmt.Errorf("unknown watchpoint option %q", arg)
+		}
+	}
+	return w, nil
+}
+
+// argAddr parses args[i] as the name of a symbol or
+// a hexadecimal address like 0150, $0150 or 0x0150.
+func (d *Debugger) argAddr(args []string, i int) (uint16, error) {
+	if len(args) <= i {
+		return 0, fmt.Errorf("%s: missing address", args[0])
+	}
+	if addr, ok := d.Labels.Lookup(args[i]); ok {
+		return addr, nil
+	}
+	s := strings.TrimPrefix(strings.TrimPrefix(args[i], "$"), "0x")
+	v, err := strconv.ParseUint(s, 16, 16)
+	if err != nil {
+		return 0, fmt.Errorf("%s: bad address %q", args[0], args[i])
+	}
+	return uint16(v), nil
+}
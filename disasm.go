@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"tgb/disasm"
+)
+
+func disasmCommand(args []string) error {
+	fs := flag.NewFlagSet("disasm", flag.ExitOnError)
+	start := fs.String("start", "0x0100", "address or symbol to start at")
+	count := fs.Int("n", 32, "number of instructions")
+	symPath := fs.String("sym", "", "symbol file, <rom>.sym is loaded if it exists")
+	analyze := fs.Bool("analyze", false, "follow the code from the entry points, list everything from -start to 7FFF and show the data as DB")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("disasm: expected exactly one ROM")
+	}
+
+	rom, err := ioutil.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	syms, labels, err := loadSymbols(*symPath, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	addr, err := strconv.ParseUint(*start, 0, 16)
+	if err != nil {
+		symAddr, ok := labels.Lookup(*start)
+		if !ok {
+			return fmt.Errorf("disasm: bad start address %q", *start)
+		}
+		addr = uint64(symAddr)
+	}
+
+	if *analyze {
+		a := disasm.Analyze(rom, disasm.Entries)
+		a.Listing(os.Stdout, uint16(addr), 0x8000, syms)
+		return nil
+	}
+
+	for i := 0; i < *count && int(addr) < len(rom); i++ {
+		in := disasm.DecodeBytes(rom[addr:], uint16(addr))
+		if name, ok := syms[uint16(addr)]; ok {
+			fmt.Printf("%s:\n", name)
+		}
+		fmt.Printf("%04X  %-9s %s\n", addr, in.Hex(), in.Text(syms))
+		addr = uint64(in.Next())
+		if addr == 0 {
+			break
+		}
+	}
+	return nil
+}
+
+// loadSymbols loads the symbol file at path. Without a path, it loads
+// the file next to the ROM with the extension .sym, as RGBDS names it,
+// if there is one.
+func loadSymbols(path, rom string) (disasm.Symbols, disasm.Labels, error) {
+	if path != "" {
+		return disasm.LoadSymbols(path)
+	}
+	path = strings.TrimSuffix(rom, filepath.Ext(rom)) + ".sym"
+	if _, err := os.Stat(path); err != nil {
+		return nil, nil, nil
+	}
+	return disasm.LoadSymbols(path)
+}
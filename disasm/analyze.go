@@ -0,0 +1,135 @@
+package disasm
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Entries are where the execution of a cartridge starts:
+// the entry point and the interrupt vectors.
+var Entries = []uint16{0x0100, 0x0040, 0x0048, 0x0050, 0x0058, 0x0060}
+
+// Analysis tells code from data in a ROM by following every jump and
+// call from the entry points (recursive descent). The bytes never
+// reached are data.
+//
+// Only 0000-7FFF is analyzed, with ROM bank 1 at 4000-7FFF.
+// The code jumped to through a register (JP HL) or copied to RAM
+// isn't found.
+type Analysis struct {
+	rom []byte
+	// start of an instruction
+	starts map[uint16]bool
+	// part of an instruction
+	code map[uint16]bool
+	// targets of the jumps and calls
+	targets map[uint16]bool
+}
+
+// Analyze finds the code reachable from entries, usually Entries.
+func Analyze(rom []byte, entries []uint16) *Analysis {
+	a := &Analysis{
+		rom:     rom,
+		starts:  map[uint16]bool{},
+		code:    map[uint16]bool{},
+		targets: map[uint16]bool{},
+	}
+
+	queue := append([]uint16{}, entries...)
+	for len(queue) > 0 {
+		addr := queue[0]
+		queue = queue[1:]
+
+		for a.inROM(addr) && !a.code[addr] {
+			in := Decode(a.read, addr)
+			if !in.Valid() || !a.inROM(in.Next()-1) {
+				break
+			}
+			a.starts[addr] = true
+			for i := range in.Bytes {
+				a.code[addr+uint16(i)] = true
+			}
+
+			flow := in.Flow()
+			if target, ok := in.Target(); ok {
+				a.targets[target] = true
+				queue = append(queue, target)
+			}
+			if flow == Jump || flow == Return {
+				break
+			}
+			addr = in.Next()
+		}
+	}
+	return a
+}
+
+func (a *Analysis) inROM(addr uint16) bool {
+	return addr < 0x8000 && int(addr) < len(a.rom)
+}
+
+func (a *Analysis) read(addr uint16) uint8 {
+	if !a.inROM(addr) {
+		return 0
+	}
+	return a.rom[addr]
+}
+
+// IsCode reports whether an instruction starts at addr.
+func (a *Analysis) IsCode(addr uint16) bool {
+	return a.starts[addr]
+}
+
+// Targets returns the addresses jumped to or called, in order.
+func (a *Analysis) Targets() []uint16 {
+	var addrs []uint16
+	for addr := range a.targets {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+	return addrs
+}
+
+// Labels returns syms with a name like "L0150" added for
+// every target without a symbol.
+func (a *Analysis) Labels(syms Symbols) Symbols {
+	labels := Symbols{}
+	for addr := range a.targets {
+		labels[addr] = fmt.Sprintf("L%04X", addr)
+	}
+	for addr, name := range syms {
+		labels[addr] = name
+	}
+	return labels
+}
+
+// Listing writes start to end (exclusive) with the labels of Labels,
+// the instructions as text and the rest as DB, at most 8 bytes a line.
+func (a *Analysis) Listing(w io.Writer, start, end uint16, syms Symbols) {
+	labels := a.Labels(syms)
+	for addr := start; addr < end && a.inROM(addr); {
+		if name, ok := labels[addr]; ok {
+			fmt.Fprintf(w, "%s:\n", name)
+		}
+
+		if a.starts[addr] {
+			in := Decode(a.read, addr)
+			fmt.Fprintf(w, "%04X  %-9s %s\n", addr, in.Hex(), in.Text(labels))
+			addr = in.Next()
+			continue
+		}
+
+		from := addr
+		data := fmt.Sprintf("DB $%02X", a.rom[addr])
+		addr++
+		for n := 1; n < 8 && addr < end && a.inROM(addr) && !a.code[addr]; n++ {
+			if _, ok := labels[addr]; ok {
+				break
+			}
+			data += fmt.Sprintf(",$%02X", a.rom[addr])
+			addr++
+		}
+		fmt.Fprintf(w, "%04X  %-9s %s\n", from, "", data)
+	}
+}
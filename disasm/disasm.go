@@ -0,0 +1,186 @@
+// Package disasm decodes SM83 machine code into text like
+// "LD BC,$1234" or "JR NZ,$0150" and tells code from data in a ROM.
+package disasm
+
+import (
+	"fmt"
+	"strings"
+	"tgb/cpu"
+)
+
+// Symbols names addresses, e.g. the labels of a ROM or the hardware registers.
+type Symbols map[uint16]string
+
+// Instruction is one decoded instruction.
+type Instruction struct {
+	Addr  uint16
+	Bytes []uint8
+	// One of Templates or CBTemplates, empty for an unused opcode.
+	Template string
+}
+
+// Decode decodes the instruction at addr, read returns the byte at an address.
+func Decode(read func(addr uint16) uint8, addr uint16) Instruction {
+	op := read(addr)
+	n := cpu.OperandLength(op)
+	template := Templates[op]
+	switch {
+	case op == 0xCB:
+		n = 1
+		template = CBTemplates[read(addr+1)]
+	case n < 0:
+		n = 0
+	}
+
+	bytes := make([]uint8, 1+n)
+	for i := range bytes {
+		bytes[i] = read(addr + uint16(i))
+	}
+	return Instruction{Addr: addr, Bytes: bytes, Template: template}
+}
+
+// DecodeBytes decodes the instruction at the start of b, which is at addr.
+// The missing bytes at the end of b are read as 0.
+func DecodeBytes(b []uint8, addr uint16) Instruction {
+	return Decode(func(a uint16) uint8 {
+		if i := int(a - addr); i < len(b) {
+			return b[i]
+		}
+		return 0
+	}, addr)
+}
+
+func (in Instruction) Valid() bool {
+	return in.Template != ""
+}
+
+// Next returns the address of the following instruction.
+func (in Instruction) Next() uint16 {
+	return in.Addr + uint16(len(in.Bytes))
+}
+
+func (in Instruction) mnemonic() (string, string) {
+	i := strings.Index(in.Template, " ")
+	if i < 0 {
+		return in.Template, ""
+	}
+	return in.Template[:i], in.Template[i+1:]
+}
+
+func (in Instruction) imm8() uint8 {
+	return in.Bytes[len(in.Bytes)-1]
+}
+
+func (in Instruction) imm16() uint16 {
+	return uint16(in.Bytes[1]) | uint16(in.Bytes[2])<<8
+}
+
+// Flow tells where the execution goes after an instruction.
+type Flow int
+
+const (
+	// to the next instruction
+	Continue Flow = iota
+	// to the target or the next instruction, e.g. JR NZ or RET Z
+	Branch
+	// only to the target
+	Jump
+	// to the target, which returns to the next instruction
+	Call
+	// somewhere unknown, e.g. RET, JP HL or an unused opcode
+	Return
+)
+
+func (in Instruction) Flow() Flow {
+	if !in.Valid() {
+		return Return
+	}
+	mnemonic, args := in.mnemonic()
+	switch mnemonic {
+	case "JP", "JR":
+		if args == "HL" {
+			return Return
+		}
+		if strings.Contains(args, ",") {
+			return Branch
+		}
+		return Jump
+	case "CALL", "RST":
+		return Call
+	case "RET":
+		if args == "" {
+			return Return
+		}
+		return Branch
+	case "RETI":
+		return Return
+	}
+	return Continue
+}
+
+// Target returns the address a JP, JR, CALL or RST goes to.
+func (in Instruction) Target() (uint16, bool) {
+	mnemonic, args := in.mnemonic()
+	switch {
+	case mnemonic == "JR":
+		return in.Next() + uint16(int8(in.imm8())), true
+	case (mnemonic == "JP" || mnemonic == "CALL") && strings.HasSuffix(args, "a16"):
+		return in.imm16(), true
+	case mnemonic == "RST":
+		return uint16(in.Bytes[0] & 0x38), true
+	}
+	return 0, false
+}
+
+// Text returns the instruction with its operand, e.g. "LD BC,$1234".
+// The addresses found in syms are replaced by their names.
+// An unused opcode is shown as data, e.g. "DB $D3".
+func (in Instruction) Text(syms Symbols) string {
+	if !in.Valid() {
+		return fmt.Sprintf("DB $%02X", in.Bytes[0])
+	}
+
+	name := func(addr uint16, format string) string {
+		if s, ok := syms[addr]; ok {
+			return s
+		}
+		return fmt.Sprintf(format, addr)
+	}
+	// e.g. "SP+$05" and "SP-$03" or "$05" and "-$03"
+	signed := func(base, plus string) string {
+		e := int8(in.imm8())
+		if e < 0 {
+			return fmt.Sprintf("%s-$%02X", base, -int(e))
+		}
+		return fmt.Sprintf("%s%s$%02X", base, plus, e)
+	}
+
+	t := in.Template
+	switch {
+	case strings.Contains(t, "n16"):
+		return strings.Replace(t, "n16", name(in.imm16(), "$%04X"), 1)
+	case strings.Contains(t, "a16"):
+		return strings.Replace(t, "a16", name(in.imm16(), "$%04X"), 1)
+	case strings.Contains(t, "a8"):
+		return strings.Replace(t, "a8", name(0xFF00|uint16(in.imm8()), "$%04X"), 1)
+	case strings.Contains(t, "n8"):
+		return strings.Replace(t, "n8", fmt.Sprintf("$%02X", in.imm8()), 1)
+	case strings.Contains(t, "SP+e8"):
+		return strings.Replace(t, "SP+e8", signed("SP", "+"), 1)
+	case strings.HasPrefix(t, "JR "):
+		target, _ := in.Target()
+		return strings.Replace(t, "e8", name(target, "$%04X"), 1)
+	case strings.Contains(t, "e8"):
+		return strings.Replace(t, "e8", signed("", ""), 1)
+	}
+	return t
+}
+
+// Hex returns the bytes of the instruction like "01 34 12".
+func (in Instruction) Hex() string {
+	s := make([]string, len(in.Bytes))
+	for i, b := range in.Bytes {
+		s[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(s, " ")
+}
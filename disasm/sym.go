@@ -0,0 +1,108 @@
+package disasm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Label is where a name of a symbol file points.
+type Label struct {
+	Bank uint16
+	Addr uint16
+}
+
+// Labels finds every name of a symbol file, including the ones
+// Symbols has no room for.
+type Labels map[string]Label
+
+// ReadSymbols reads a symbol file of RGBDS or no$gmb, e.g.
+//
+//	; comment
+//	00:0150 Main
+//	01:4000 Bank1Data
+//
+// Symbols are for showing the addresses: only one bank can be at
+// 4000-7FFF, and the address space has room for one name per address.
+// Bank 0 and 1 win over the other banks, then the first name of an
+// address wins. Labels keep every name to look it up.
+func ReadSymbols(r io.Reader) (Symbols, Labels, error) {
+	syms := Symbols{}
+	labels := Labels{}
+	banks := map[uint16]uint64{}
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if i := strings.Index(line, ";"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, nil, fmt.Errorf("line %d: expected \"bank:addr label\"", n)
+		}
+
+		parts := strings.Split(fields[0], ":")
+		if len(parts) != 2 {
+			return nil, nil, fmt.Errorf("line %d: bad address %q", n, fields[0])
+		}
+		bank, err := strconv.ParseUint(parts[0], 16, 16)
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: bad bank %q", n, parts[0])
+		}
+		v, err := strconv.ParseUint(parts[1], 16, 16)
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: bad address %q", n, parts[1])
+		}
+		addr := uint16(v)
+
+		if _, ok := labels[fields[1]]; !ok {
+			labels[fields[1]] = Label{Bank: uint16(bank), Addr: addr}
+		}
+
+		if b, ok := banks[addr]; ok && (b <= 1 || bank > 1) {
+			continue
+		}
+		syms[addr] = fields[1]
+		banks[addr] = bank
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	return syms, labels, nil
+}
+
+// LoadSymbols reads the symbol file at path.
+func LoadSymbols(path string) (Symbols, Labels, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	syms, labels, err := ReadSymbols(f)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return syms, labels, nil
+}
+
+// Lookup returns the address of name.
+func (l Labels) Lookup(name string) (uint16, bool) {
+	label, ok := l[name]
+	return label.Addr, ok
+}
+
+// Name returns the name of addr like "Main", or "$0150" without a symbol.
+func (s Symbols) Name(addr uint16) string {
+	if name, ok := s[addr]; ok {
+		return name
+	}
+	return fmt.Sprintf("$%04X", addr)
+}
@@ -0,0 +1,11 @@
+package disasm
+
+import "tgb/cpu"
+
+// Templates and CBTemplates are the instructions of each opcode in the
+// syntax of RGBDS. The tables live in package cpu so that cpu.Label and
+// the disassembler can't disagree on them; see cpu.Templates.
+var (
+	Templates   = cpu.Templates
+	CBTemplates = cpu.CBTemplates
+)
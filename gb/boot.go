@@ -0,0 +1,147 @@
+package gb
+
+import (
+	"hash/crc32"
+	"tgb/apu"
+	"tgb/gpu"
+	"tgb/timer"
+)
+
+// Without a boot ROM, the boot sequence is done here:
+//
+//	- the logo at 0x0104-0x0133 of the cartridge is drawn in VRAM
+//	- it scrolls down from the top of the screen and the chime is played
+//	- the logo and the header checksum are compared, and if they don't
+//	  match the Game Boy locks up
+//	- the registers are left as NewCPUFor() and setMemoryValueInBoot() set them
+
+const (
+	// The logo is 24 tiles from 0x8010, the ® mark follows them.
+	LOGO_TILES      = 0x8010
+	REGISTERED_TILE = 0x8190
+
+	// The logo scrolls 1 line every 2 frames from SCY=100 to 0,
+	// then stays still for 32 more steps.
+	LOGO_SCROLL_STEPS = 100
+	LOGO_PAUSE_STEPS  = 32
+	FRAMES_LOGO_STEP  = 2
+
+	// CRC-32 of the logo every licensed cartridge has, so that
+	// the logo itself doesn't have to be stored here.
+	LOGO_CRC32 = 0x46195417
+)
+
+// ® drawn in color 1
+var registeredMark = [8]uint8{0x3C, 0x42, 0xB9, 0xA5, 0xB9, 0xA5, 0x42, 0x3C}
+
+func (gb *GB) displayLogo() {
+	for addr := 0x8000; addr < 0xA000; addr++ {
+		gb.write(uint16(addr), 0x00)
+	}
+
+	// Square 1 plays the chime.
+	gb.write(apu.NR52, 0x80)
+	gb.write(apu.NR11, 0x80)
+	gb.write(apu.NR12, 0xF3)
+	gb.write(apu.NR51, 0xF3)
+	gb.write(apu.NR50, 0x77)
+	gb.write(gpu.BGP, 0xFC)
+
+	// Each nibble of the logo is a row of 4 pixels.
+	// The pixels are doubled to 8 and every row is written twice.
+	addr := uint16(LOGO_TILES)
+	for _, b := range gb.ROM[0x0104:0x0134] {
+		for _, nibble := range []uint8{b >> 4, b & 0x0F} {
+			row := doubleBits(nibble)
+			gb.write(addr, row)
+			gb.write(addr+2, row)
+			addr += 4
+		}
+	}
+	for i, row := range registeredMark {
+		gb.write(REGISTERED_TILE+uint16(i)*2, row)
+	}
+
+	// The ® is tile 0x19 at the right of the upper row,
+	// tiles 0x01-0x0C are the upper row and 0x0D-0x18 the lower row.
+	gb.write(0x9910, 0x19)
+	tile := uint8(0x18)
+	for _, end := range []uint16{0x992F, 0x990F} {
+		for i := uint16(0); i < 12; i++ {
+			gb.write(end-i, tile)
+			tile--
+		}
+	}
+
+	gb.write(gpu.SCY, LOGO_SCROLL_STEPS)
+	gb.write(gpu.LCDC, 0x91)
+
+	// Nobody sees the scroll without a window.
+	if gb.Headless {
+		gb.write(gpu.SCY, 0x00)
+		return
+	}
+	gb.scrollLogo()
+}
+
+func (gb *GB) scrollLogo() {
+	for step := 1; step <= LOGO_SCROLL_STEPS+LOGO_PAUSE_STEPS; step++ {
+		for i := 0; i < FRAMES_LOGO_STEP; i++ {
+			gb.bootFrame()
+			if gb.quit {
+				return
+			}
+		}
+
+		// "po-" then "ling!"
+		switch step {
+		case LOGO_SCROLL_STEPS - 2:
+			gb.write(apu.NR13, 0x83)
+			gb.write(apu.NR14, 0x87)
+		case LOGO_SCROLL_STEPS:
+			gb.write(apu.NR13, 0xC1)
+			gb.write(apu.NR14, 0x87)
+		}
+
+		if step <= LOGO_SCROLL_STEPS {
+			gb.write(gpu.SCY, gb.read(gpu.SCY)-1)
+		}
+	}
+}
+
+// bootFrame advances the GPU and the APU by a frame while the CPU waits.
+func (gb *GB) bootFrame() {
+	for c := 0; c < timer.CYCLES_FRAME; c += gpu.CYCLES_LINE {
+		gb.GPU.UpdateGraphics(gpu.CYCLES_LINE)
+		gb.APU.Update(gpu.CYCLES_LINE)
+	}
+	gb.renderScreen()
+	gb.outputAudio()
+	gb.handleEvents()
+}
+
+// doubleBits turns the 4 bits abcd into aabbccdd.
+func doubleBits(nibble uint8) uint8 {
+	var row uint8
+	for bit := 3; bit >= 0; bit-- {
+		row <<= 2
+		if nibble>>uint(bit)&0x01 != 0 {
+			row |= 0x03
+		}
+	}
+	return row
+}
+
+func (gb *GB) checkLogoArea() bool {
+	if crc32.ChecksumIEEE(gb.ROM[0x0104:0x0134]) != LOGO_CRC32 {
+		return false
+	}
+
+	// 0x014D - Header Checksum
+	//   x=0:FOR i=0134h TO 014Ch:x=x-MEM[i]-1:NEXT
+	var x uint8
+	for _, b := range gb.ROM[0x0134:0x014D] {
+		x = x - b - 1
+	}
+	return x == gb.ROM[0x014D]
+}
@@ -0,0 +1,75 @@
+package gb
+
+import (
+	"log"
+	"tgb/joypad"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// handleEvents drains the SDL event queue once per frame.
+func (gb *GB) handleEvents() {
+	if gb.Headless {
+		return
+	}
+	for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
+		switch e := event.(type) {
+		case *sdl.QuitEvent:
+			gb.quit = true
+		case *sdl.KeyboardEvent:
+			if e.Keysym.Sym == REWIND_KEY {
+				gb.rewinding = e.State == sdl.PRESSED && gb.rewind != nil
+				break
+			}
+			if !gb.handleStateKey(e) {
+				joypad.HandleEvent(gb.Joypad, event)
+			}
+		default:
+			joypad.HandleEvent(gb.Joypad, event)
+		}
+	}
+}
+
+// The game goes back frame by frame while REWIND_KEY is held down.
+const REWIND_KEY = sdl.K_r
+
+// stateKeys are the hotkeys of the save state slots: F1-F9 load
+// a slot, Shift+F1-F9 save to it.
+var stateKeys = map[sdl.Keycode]int{
+	sdl.K_F1: 1,
+	sdl.K_F2: 2,
+	sdl.K_F3: 3,
+	sdl.K_F4: 4,
+	sdl.K_F5: 5,
+	sdl.K_F6: 6,
+	sdl.K_F7: 7,
+	sdl.K_F8: 8,
+	sdl.K_F9: 9,
+}
+
+// handleStateKey saves or loads a state if e is one of stateKeys.
+// It reports whether the event was consumed.
+func (gb *GB) handleStateKey(e *sdl.KeyboardEvent) bool {
+	slot, ok := stateKeys[e.Keysym.Sym]
+	if !ok {
+		return false
+	}
+	if e.State != sdl.PRESSED || e.Repeat != 0 {
+		return true
+	}
+
+	if e.Keysym.Mod&sdl.KMOD_SHIFT != 0 {
+		if err := gb.SaveSlot(slot); err != nil {
+			log.Println(err)
+			return true
+		}
+		log.Printf("Saved state %d to %s", slot, gb.StatePath(slot))
+		return true
+	}
+	if err := gb.LoadSlot(slot); err != nil {
+		log.Println(err)
+		return true
+	}
+	log.Printf("Loaded state %d", slot)
+	return true
+}
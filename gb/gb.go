@@ -1,15 +1,25 @@
 package gb
 
 import (
+	"bytes"
 	"fmt"
 	// "time"
 	"errors"
+	"io"
 	"io/ioutil"
+	"log"
+	"tgb/apu"
 	"tgb/cpu"
+	"tgb/disasm"
 	"tgb/gpu"
 	"tgb/interrupt"
+	"tgb/joypad"
 	"tgb/memory"
+	"tgb/model"
+	"tgb/serial"
+	"tgb/sgb"
 	"tgb/timer"
+	"tgb/trace"
 )
 
 type GB struct {
@@ -17,12 +27,59 @@ type GB struct {
 	GPU     *gpu.GPU
 	ROM     []byte
 	RomInfo Rom_info
-	Memory *[0x10000]uint8
+	// file the ROM was read from, save states are named after it
+	romPath   string
+	Memory    *memory.Memory
+	Interrupt *interrupt.Interrupt
 
 	// 4.194304MHz / 256 = 16.384KHz
 	Timer *timer.Timer
 
+	// Hardware being emulated, never model.Auto
+	Model model.Model
+	// CGB functions are used by the cartridge
+	CGBMode bool
+
+	APU *apu.APU
+
+	// Audio receives the APU output once per frame. It may be nil.
+	Audio apu.AudioSink
+
+	Joypad *joypad.Joypad
+
+	// SGB is set when the cartridge uses the SGB functions on an SGB.
+	SGB *sgb.SGB
+
+	// Script, if set, is replayed on Joypad in addition to the keyboard.
+	Script *joypad.Script
+
+	Serial *serial.Serial
+
+	// SerialLog collects every byte sent over the serial port.
+	SerialLog bytes.Buffer
+	// SerialOutput, if set, also receives every byte sent, e.g. os.Stdout.
+	SerialOutput io.Writer
+	serialUpdated bool
+
+	Headless bool
+	// Run stops after MaxFrames frames unless it is 0.
+	MaxFrames int
+	SaveDir   string
+	trace     io.Writer
+	symbols   disasm.Symbols
+	// run instead of the built-in boot sequence when set
+	bootROM []byte
+
 	current_cycle int
+	frame         int
+	quit          bool
+
+	// nil unless Config.RewindInterval is set
+	rewind *RewindBuffer
+	// the rewind key is held down
+	rewinding bool
+	// RewindTo is running frames again
+	replaying bool
 }
 
 type Rom_info struct {
@@ -93,22 +150,121 @@ var ramSizeMap map[byte]int = map[byte]int{
 	0x03: 32768,
 }
 
-func New(filename string) *GB {
+// Config holds the settings chosen on the command line.
+type Config struct {
+	// Size of a Game Boy pixel on the window
+	Scale int
+	// One of gpu.Palettes
+	Palette string
+	// Run without a window
+	Headless bool
+	// Stop after this many frames, 0 runs until the window is closed.
+	Frames int
+	// Boot ROM to execute instead of skipping the boot sequence
+	BootROM string
+	// Directory for save data
+	SaveDir string
+	// Trace, if set, receives a line for every executed instruction,
+	// see the trace package.
+	Trace io.Writer
+	// Names of the addresses shown in the trace
+	Symbols disasm.Symbols
+	// Hardware to emulate, model.Auto chooses from the cartridge header.
+	Model model.Model
+	// Make the CGB colors look like on the real LCD
+	ColorCorrection bool
+	// Take a snapshot for rewinding every RewindInterval frames,
+	// 0 turns rewinding off. The snapshots take at most RewindBudget bytes.
+	RewindInterval int
+	RewindBudget   int
+}
+
+func New(filename string, cfg Config) (*GB, error) {
 	var gb *GB
 
 	rom, err := ioutil.ReadFile(filename)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	if len(rom) < 0x150 {
+		return nil, errors.New("The ROM is too small to have a cartridge header.")
 	}
 	ri := getRomInfo(rom)
 
+	m := cfg.Model
+	if m == model.Auto {
+		m = model.DMG
+		if ri.CGBFlag {
+			m = model.CGB
+		}
+	}
+	// The SGB functions are only unlocked for cartridges with
+	// SGB flag 03h and old licensee code 33h.
+	sgbMode := m == model.SGB && ri.SGBFlag && ri.oldLicenseeCode == 0x33
+	// On a CGB, the cartridges for the older models run in
+	// non CGB mode, which is almost the same as a DMG.
+	cgbMode := (m == model.CGB || m == model.AGB) && ri.CGBFlag
+	var bootROM []byte
+	if cfg.BootROM != "" {
+		bootROM, err = ioutil.ReadFile(cfg.BootROM)
+		if err != nil {
+			return nil, err
+		}
+		if m == model.CGB || m == model.AGB {
+			return nil, errors.New("Only the DMG boot ROM can be run.")
+		}
+		if len(bootROM) != 0x100 {
+			return nil, fmt.Errorf("The DMG boot ROM is 256 bytes, %s has %d.", cfg.BootROM, len(bootROM))
+		}
+	}
+
+	mem := memory.New()
+	irq := interrupt.New(mem)
+
 	gb = &GB{
-		CPU:     cpu.NewCPUinBoot(),
-		GPU:     gpu.New(),
+		CPU:     cpu.NewCPUinBoot(mem, irq),
+		GPU:     gpu.New(mem, irq),
 		ROM:     rom,
 		RomInfo: ri,
-		Memory: &memory.Data,
-		Timer: timer.New(),
+		romPath: filename,
+		Memory: mem,
+		Interrupt: irq,
+		Timer: timer.New(mem, irq),
+		APU: apu.New(mem, apu.DEFAULT_SAMPLE_RATE),
+		Joypad: joypad.New(mem, irq),
+		Serial: serial.New(mem, irq),
+		Headless: cfg.Headless,
+		MaxFrames: cfg.Frames,
+		SaveDir: cfg.SaveDir,
+		trace: cfg.Trace,
+		symbols: cfg.Symbols,
+		bootROM: bootROM,
+		Model: m,
+		CGBMode: cgbMode,
+	}
+	gb.Serial.OnTransfer = gb.captureSerial
+	if cfg.RewindInterval > 0 {
+		gb.rewind = NewRewindBuffer(cfg.RewindInterval, cfg.RewindBudget)
+	}
+
+	if cfg.Scale > 0 {
+		gb.GPU.Scale = int32(cfg.Scale)
+	}
+	if cfg.Palette != "" {
+		palette, ok := gpu.Palettes[cfg.Palette]
+		if !ok {
+			return nil, fmt.Errorf("Unknown palette %q.", cfg.Palette)
+		}
+		gb.GPU.Palette = palette
+	}
+	if gb.CGBMode {
+		gb.Memory.EnableCGB()
+		gb.GPU.EnableCGB()
+	}
+	gb.GPU.ColorCorrection = cfg.ColorCorrection
+	if sgbMode {
+		gb.SGB = sgb.New(gb.Joypad, gb.Memory)
+		gb.GPU.SGBFrame = new([gpu.SGB_WIDTH][gpu.SGB_HEIGHT]uint32)
 	}
 
 	switch ri.cartridgeType {
@@ -116,30 +272,62 @@ func New(filename string) *GB {
 		gb.loadROMtoRAM(rom, 0x8000)
 	default:
 	}
-	return gb
+	return gb, nil
+}
+
+// ReadRomInfo parses the cartridge header of filename.
+func ReadRomInfo(filename string) (Rom_info, error) {
+	rom, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return Rom_info{}, err
+	}
+	if len(rom) < 0x150 {
+		return Rom_info{}, errors.New("The ROM is too small to have a cartridge header.")
+	}
+	return getRomInfo(rom), nil
 }
 
 func (gb *GB) Boot() error {
+	if gb.bootROM != nil {
+		return gb.runBootROM()
+	}
+
+	if !gb.Headless {
+		gb.GPU.Init()
+	}
+
 	// 0x0104 - 0x0133
 	gb.displayLogo()
 	result := gb.checkLogoArea()
 	if !result {
-		return errors.New("Compared the ROM and internal memory in 0x0104-0x0133, but didn't get exactly coincide.")
+		return errors.New("Compared the ROM and internal memory in 0x0104-0x0133 and the header checksum, but didn't get exactly coincide.")
 	}
 
 	// Bootときに設定した各レジスタを初期値に上書きする
-	gb.CPU = cpu.NewCPU()
-	gb.GPU.Init()
+	gb.CPU = cpu.NewCPUFor(gb.Memory, gb.Interrupt, gb.Model, gb.ROM[0x014D])
+	if gb.CGBMode {
+		gb.CPU.EnableCGB()
+	}
 	gb.setMemoryValueInBoot()
 	return nil
 }
 
+// runBootROM maps the boot ROM over 0000-00FF and lets the CPU start from 0.
+// It scrolls the logo, compares it and unmaps itself by writing FF50.
+func (gb *GB) runBootROM() error {
+	gb.Memory.BootROM = gb.bootROM
+	if !gb.Headless {
+		gb.GPU.Init()
+	}
+	return nil
+}
+
 func (gb *GB) write(addr uint16, val uint8) {
-	memory.Write(addr, val)
+	gb.Memory.Write(addr, val)
 }
 
 func (gb *GB) read(addr uint16) uint8 {
-	return memory.Read(addr)
+	return gb.Memory.Read(addr)
 }
 
 func (gb *GB) loadROMtoRAM(rom []byte, size int) {
@@ -152,9 +340,9 @@ func (gb *GB) loadROMtoRAM(rom []byte, size int) {
 func getRomInfo(rom_data []byte) Rom_info {
 	return Rom_info{
 		entryPoint:   rom_data[0x0100:0x103],
-		nintendoLogo: rom_data[0x0104:0x0133],
+		nintendoLogo: rom_data[0x0104:0x0134],
 		Title:        fetchTitle(rom_data[0x0134:0x0143]),
-		//CGBFlag: ,
+		CGBFlag:              checkCGBFlag(rom_data[0x0143]),
 		newLicenseeCode:      rom_data[0x0144:0x145],
 		SGBFlag:              checkSGBFlag(rom_data[0x146]),
 		cartridgeType:        cartridgeTypeMap[rom_data[0x147]],
@@ -177,6 +365,13 @@ func fetchTitle(bytes []byte) string {
 	return title
 }
 
+// 0x0143 - CGB Flag
+//  80h - Game supports CGB functions, but works on old gameboys also.
+//  C0h - Game works on CGB only (physically the same as 80h).
+func checkCGBFlag(b byte) bool {
+	return b&0x80 != 0
+}
+
 func checkSGBFlag(b byte) bool {
 	if b == 0x03 {
 		return true
@@ -186,32 +381,145 @@ func checkSGBFlag(b byte) bool {
 
 func (gb *GB) Run() {
 	gb.Update()
+
+	if gb.Audio != nil {
+		if err := gb.Audio.Close(); err != nil {
+			log.Println(err)
+		}
+	}
 }
 
 // Should be called 60 times/second
 func (gb *GB) Update() {
-	for {
-		if interrupt.CheckInterrupts() {
-			// the CPU will push the current PC into the stack, will jump
-			// to the corresponding interrupt vector and set IME to '0'.
-			// If IME is '0', this won't happen.
-			gb.CPU.PushCurrentPC()
-			interrupt.CheckInterruptVector()
+	for !gb.Done() {
+		gb.Step()
+	}
+}
+
+// Frame returns the number of frames run so far.
+func (gb *GB) Frame() int {
+	return gb.frame
+}
+
+// Done reports whether the window was closed or MaxFrames have been run.
+func (gb *GB) Done() bool {
+	return gb.quit || gb.MaxFrames > 0 && gb.frame >= gb.MaxFrames
+}
+
+// Step executes one instruction and advances the other components
+// by the same amount of time. It returns the clock cycles at 4.194304MHz.
+func (gb *GB) Step() int {
+	var cycles int
+	if gb.Interrupt.CheckInterrupts() {
+		// the CPU will push the current PC into the stack, will jump
+		// to the corresponding interrupt vector and set IME to '0'.
+		// If IME is '0', this won't happen.
+		cycles = gb.CPU.Interrupt(gb.Interrupt.CheckInterruptVector())
+	} else {
+		if gb.trace != nil && !gb.CPU.Halted() {
+			trace.Write(gb.trace, gb.CPU, gb.Memory, gb.symbols)
+		}
+		cycles = gb.CPU.Step()
+	}
+	// The CPU counts machine cycles, the other components count clock cycles.
+	cycles *= 4
+
+	clocks := gb.advance(cycles)
+
+	// The CPU is halted while the VRAM DMA copies.
+	for stall := gb.GPU.TakeDMAStall(); stall > 0; stall = gb.GPU.TakeDMAStall() {
+		if gb.CPU.DoubleSpeed() {
+			stall *= 2
+		}
+		clocks += gb.advance(stall)
+	}
+	return clocks
+}
+
+// advance runs every component but the CPU for cycles of the CPU clock
+// and returns how many clock cycles at 4.194304MHz passed.
+func (gb *GB) advance(cycles int) int {
+	// In double speed the timer and the serial port are clocked
+	// with the CPU, the GPU and the APU keep their speed.
+	clocks := cycles
+	if gb.CPU.DoubleSpeed() {
+		clocks /= 2
+	}
+
+	gb.Timer.UpdateTimers(cycles)
+	gb.GPU.UpdateGraphics(clocks)
+	gb.APU.Update(clocks)
+	gb.Serial.Update(cycles)
+
+	gb.current_cycle += clocks
+	if gb.current_cycle >= timer.CYCLES_FRAME {
+		gb.current_cycle -= timer.CYCLES_FRAME
+		if !gb.replaying {
+			gb.renderScreen()
+		}
+		gb.nextFrame()
+	}
+	return clocks
+}
+
+func (gb *GB) renderScreen() {
+	if gb.SGB != nil {
+		gb.SGB.Render(&gb.GPU.Shades, gb.GPU.SGBFrame)
+	}
+	gb.GPU.RenderScreen()
+}
+
+func (gb *GB) nextFrame() {
+	gb.frame++
+	if gb.replaying {
+		gb.replayInput(gb.frame)
+		return
+	}
+	gb.outputAudio()
+	gb.handleEvents()
+
+	// The next frame brings it back to frame-1. At the oldest snapshot
+	// it goes on as if the rewind key weren't held.
+	if gb.rewinding && gb.RewindTo(gb.frame-2) {
+		return
+	}
+	if gb.Script != nil {
+		gb.Script.Update(gb.frame, gb.Joypad)
+	}
+	if gb.rewind != nil {
+		gb.rewind.record(gb.frame, gb.Joypad.Pressed())
+		if gb.frame%gb.rewind.interval == 0 {
+			gb.rewind.push(gb.snapshot(), gb.frame)
 		}
-		cycles := gb.CPU.Step()
-		fmt.Println(cycles)
-		// time.Sleep(time.Millisecond * 100)
-
-		gb.Timer.UpdateTimers(cycles)
-		gb.GPU.UpdateGraphics(cycles)
-		interrupt.DoInterrupts()
-		
-		gb.current_cycle += cycles
-		if gb.current_cycle >= timer.CYCLES_FRAME {
-			gb.current_cycle -= timer.CYCLES_FRAME
-			gb.GPU.RenderScreen()
+	}
+}
+
+func (gb *GB) outputAudio() {
+	samples := gb.APU.Flush()
+	if gb.Audio == nil {
+		return
+	}
+	if gb.rewinding {
+		// silence, the real time sinks still pace the frames
+		for i := range samples {
+			samples[i] = 0
 		}
 	}
+
+	if err := gb.Audio.Write(samples); err != nil {
+		log.Println(err)
+		// Run won't close it any more: close it now so that a WAV file
+		// gets its sizes and an SDL device is released.
+		if err := gb.Audio.Close(); err != nil {
+			log.Println(err)
+		}
+		gb.Audio = nil
+		return
+	}
+	// Real time sinks decide how fast we run.
+	if p, ok := gb.Audio.(apu.Pacer); ok {
+		p.Sync()
+	}
 }
 
 func (gb *GB) getInputClock() int {
@@ -228,47 +536,4 @@ func (gb *GB) getInputClock() int {
 	}
 
 	return -1
-}
-
-func (gb *GB) checkLogoArea() bool {
-	// FIX IT!
-	return true
-}
-
-func (gb *GB) displayLogo() {
-
-}
-
-func (gb *GB) setMemoryValueInBoot() {
-	gb.write(0xFF05, 0x00) // TIMA
-	gb.write(0xFF06, 0x00) // TMA
-	gb.write(0xFF07, 0x00) // TAC
-	gb.write(0xFF10, 0x80) // NR10
-	gb.write(0xFF11, 0xBF) // NR11
-	gb.write(0xFF12, 0xF3) // NR12
-	gb.write(0xFF14, 0xBF) // NR14
-	gb.write(0xFF16, 0x3F) // NR21
-	gb.write(0xFF17, 0x00) // NR22
-	gb.write(0xFF19, 0xBF) // NR24
-	gb.write(0xFF1A, 0x7F) // NR30
-	gb.write(0xFF1B, 0xFF) // NR31
-	gb.write(0xFF1C, 0x9F) // NR32
-	gb.write(0xFF1E, 0xBF) // NR33
-	gb.write(0xFF20, 0xFF) // NR41
-	gb.write(0xFF21, 0x00) // NR42
-	gb.write(0xFF22, 0x00) // NR43
-	gb.write(0xFF23, 0xBF) // NR30
-	gb.write(0xFF24, 0x77) // NR50
-	gb.write(0xFF25, 0xF3) // NR51
-	gb.write(0xFF26, 0xF1) // NR52
-	gb.write(0xFF40, 0x91) // LCDC
-	gb.write(0xFF42, 0x00) // SCY
-	gb.write(0xFF43, 0x00) // SCX
-	gb.write(0xFF45, 0x00) // LYC
-	gb.write(0xFF47, 0xFC) // BGP
-	gb.write(0xFF48, 0xFF) // OBP0
-	gb.write(0xFF49, 0xFF) // OBP1
-	gb.write(0xFF4A, 0x00) // WY
-	gb.write(0xFF4B, 0x00) // WX
-	gb.write(0xFFFF, 0x00) // IE
 }
\ No newline at end of file
@@ -0,0 +1,56 @@
+package gb
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"tgb/asm"
+)
+
+// The ROMs built here don't have the licensed logo, which Boot checks
+// without a boot ROM. This one only unmaps itself, and the ROM starts at 0100
+// and jumps over the header to 0150.
+const bootROM = `
+	ORG $0000
+	LD SP,$FFFE
+	LD A,1
+	JP $00FE
+	ORG $00FE
+	LDH [$50],A`
+
+// newTestGB returns a headless GB running a 32KB ROM with title and
+// code at 0150.
+func newTestGB(t *testing.T, title, code string) *GB {
+	t.Helper()
+	dir := t.TempDir()
+
+	boot := filepath.Join(dir, "boot.bin")
+	if err := ioutil.WriteFile(boot, asm.MustAssemble(bootROM), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rom := make([]uint8, 0x8000)
+	copy(rom[0x0100:], asm.MustAssemble("ORG $0100\nNOP\nJP $0150"))
+	copy(rom[0x0134:], title)
+	copy(rom[0x0150:], asm.MustAssemble("ORG $0150\n"+code))
+	path := filepath.Join(dir, "test.gb")
+	if err := ioutil.WriteFile(path, rom, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	gb, err := New(path, Config{Headless: true, BootROM: boot})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gb.Boot(); err != nil {
+		t.Fatal(err)
+	}
+	return gb
+}
+
+// runFrames steps gb until n more frames have been drawn.
+func runFrames(gb *GB, n int) {
+	for end := gb.Frame() + n; gb.Frame() < end; {
+		gb.Step()
+	}
+}
@@ -0,0 +1,97 @@
+package gb
+
+import (
+	"tgb/apu"
+	"tgb/gpu"
+	"tgb/interrupt"
+	"tgb/joypad"
+	"tgb/model"
+	"tgb/serial"
+	"tgb/timer"
+)
+
+// I/O register left by the boot ROM, one value per model
+// in the order DMG0, DMG, MGB, SGB, CGB, AGB.
+//
+// Values that Pan Docs gives as "??" (they depend on the cartridge
+// or on how long the boot took) are those of a typical cartridge.
+type ioRegister struct {
+	addr   uint16
+	values [6]uint8
+}
+
+// NR52 comes before the other sound registers, which can't be written
+// while the sound is off. LY and DMA are set by the GPU itself.
+var ioRegistersAfterBoot = []ioRegister{
+	{joypad.P1, [6]uint8{0xCF, 0xCF, 0xCF, 0xC7, 0xC7, 0xC7}},
+	{serial.SB, [6]uint8{0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+	{serial.SC, [6]uint8{0x7E, 0x7E, 0x7E, 0x7E, 0x7F, 0x7F}},
+	{timer.TIMA, [6]uint8{0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+	{timer.TMA, [6]uint8{0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+	{timer.TAC, [6]uint8{0xF8, 0xF8, 0xF8, 0xF8, 0xF8, 0xF8}},
+	{interrupt.IF, [6]uint8{0xE1, 0xE1, 0xE1, 0xE1, 0xE1, 0xE1}},
+	{apu.NR52, [6]uint8{0xF1, 0xF1, 0xF1, 0xF0, 0xF1, 0xF1}},
+	{apu.NR10, [6]uint8{0x80, 0x80, 0x80, 0x80, 0x80, 0x80}},
+	{apu.NR11, [6]uint8{0xBF, 0xBF, 0xBF, 0xBF, 0xBF, 0xBF}},
+	{apu.NR12, [6]uint8{0xF3, 0xF3, 0xF3, 0xF3, 0xF3, 0xF3}},
+	{apu.NR13, [6]uint8{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}},
+	{apu.NR14, [6]uint8{0xBF, 0xBF, 0xBF, 0xBF, 0xBF, 0xBF}},
+	{apu.NR21, [6]uint8{0x3F, 0x3F, 0x3F, 0x3F, 0x3F, 0x3F}},
+	{apu.NR22, [6]uint8{0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+	{apu.NR23, [6]uint8{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}},
+	{apu.NR24, [6]uint8{0xBF, 0xBF, 0xBF, 0xBF, 0xBF, 0xBF}},
+	{apu.NR30, [6]uint8{0x7F, 0x7F, 0x7F, 0x7F, 0x7F, 0x7F}},
+	{apu.NR31, [6]uint8{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}},
+	{apu.NR32, [6]uint8{0x9F, 0x9F, 0x9F, 0x9F, 0x9F, 0x9F}},
+	{apu.NR33, [6]uint8{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}},
+	{apu.NR34, [6]uint8{0xBF, 0xBF, 0xBF, 0xBF, 0xBF, 0xBF}},
+	{apu.NR41, [6]uint8{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}},
+	{apu.NR42, [6]uint8{0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+	{apu.NR43, [6]uint8{0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+	{apu.NR44, [6]uint8{0xBF, 0xBF, 0xBF, 0xBF, 0xBF, 0xBF}},
+	{apu.NR50, [6]uint8{0x77, 0x77, 0x77, 0x77, 0x77, 0x77}},
+	{apu.NR51, [6]uint8{0xF3, 0xF3, 0xF3, 0xF3, 0xF3, 0xF3}},
+	{gpu.LCDC, [6]uint8{0x91, 0x91, 0x91, 0x91, 0x91, 0x91}},
+	{gpu.STAT, [6]uint8{0x81, 0x85, 0x85, 0x85, 0x85, 0x85}},
+	{gpu.SCY, [6]uint8{0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+	{gpu.SCX, [6]uint8{0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+	{gpu.LYC, [6]uint8{0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+	{gpu.BGP, [6]uint8{0xFC, 0xFC, 0xFC, 0xFC, 0xFC, 0xFC}},
+	{gpu.OBP0, [6]uint8{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}},
+	{gpu.OBP1, [6]uint8{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}},
+	{gpu.WY, [6]uint8{0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+	{gpu.WX, [6]uint8{0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+	{interrupt.IE, [6]uint8{0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+}
+
+// Upper 8 bits of the internal counter, i.e. DIV, after the boot ROM.
+var divAfterBoot = [6]uint8{0x18, 0xAB, 0xAB, 0xD8, 0x1E, 0x1E}
+
+// Writing 1 to bit 7 of NRx4 would restart the channel.
+var soundTriggers = map[uint16]bool{
+	apu.NR14: true,
+	apu.NR24: true,
+	apu.NR34: true,
+	apu.NR44: true,
+}
+
+// column returns the index of m in the tables above.
+func column(m model.Model) int {
+	if m == model.Auto {
+		m = model.DMG
+	}
+	return int(m - model.DMG0)
+}
+
+// setMemoryValueInBoot sets the I/O registers as the boot ROM of gb.Model leaves them.
+func (gb *GB) setMemoryValueInBoot() {
+	col := column(gb.Model)
+	for _, r := range ioRegistersAfterBoot {
+		val := r.values[col]
+		if soundTriggers[r.addr] {
+			val &= 0x7F
+		}
+		gb.write(r.addr, val)
+	}
+	gb.Timer.InternalCounter = int(divAfterBoot[col]) << 8
+}
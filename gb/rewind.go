@@ -0,0 +1,222 @@
+package gb
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+)
+
+// RewindBuffer keeps snapshots of the last frames, so that the player
+// can go back in time. The newest snapshot is kept as it is, every
+// older one as the XOR with the next newer one, compressed: states a
+// few frames apart differ in a few bytes, the XOR is mostly zeros.
+// The oldest snapshots are dropped when all of them take more than
+// budget bytes.
+//
+// The buttons held down aren't part of a snapshot, the buffer logs them
+// every frame so that the frames after a snapshot can be run again the
+// way they were played.
+type RewindBuffer struct {
+	// A snapshot is taken every interval frames.
+	interval int
+	budget   int
+
+	newest      []byte
+	newestFrame int
+	// older snapshots, the oldest first
+	deltas []rewindDelta
+	size   int
+
+	// buttons held after each frame from inputsFrame on
+	inputs      []uint8
+	inputsFrame int
+}
+
+type rewindDelta struct {
+	frame int
+	data  []byte
+}
+
+func NewRewindBuffer(interval, budget int) *RewindBuffer {
+	if interval < 1 {
+		interval = 1
+	}
+	return &RewindBuffer{interval: interval, budget: budget}
+}
+
+// Len returns the number of snapshots.
+func (r *RewindBuffer) Len() int {
+	if r.newest == nil {
+		return 0
+	}
+	return len(r.deltas) + 1
+}
+
+// Size returns the bytes taken by the snapshots.
+func (r *RewindBuffer) Size() int {
+	return r.size + len(r.newest)
+}
+
+// push adds the snapshot of frame, which is newer than the others.
+func (r *RewindBuffer) push(state []byte, frame int) {
+	if r.newest != nil {
+		d := rewindDelta{frame: r.newestFrame, data: deflate(xor(r.newest, state))}
+		r.deltas = append(r.deltas, d)
+		r.size += len(d.data)
+	}
+	r.newest = state
+	r.newestFrame = frame
+
+	for r.Size() > r.budget && len(r.deltas) > 0 {
+		r.size -= len(r.deltas[0].data)
+		r.deltas[0] = rewindDelta{}
+		r.deltas = r.deltas[1:]
+	}
+
+	// the inputs before the oldest snapshot aren't needed anymore
+	oldest := r.newestFrame
+	if len(r.deltas) > 0 {
+		oldest = r.deltas[0].frame
+	}
+	if n := oldest - r.inputsFrame; n > 0 && n <= len(r.inputs) {
+		r.inputs = r.inputs[n:]
+		r.inputsFrame = oldest
+	}
+}
+
+// record logs the buttons held after frame. A frame that was logged
+// before is overwritten, and the frames after it are dropped.
+func (r *RewindBuffer) record(frame int, pressed uint8) {
+	n := frame - r.inputsFrame
+	if len(r.inputs) == 0 || n < 0 || n > len(r.inputs) {
+		r.inputs, r.inputsFrame, n = nil, frame, 0
+	}
+	r.inputs = append(r.inputs[:n], pressed)
+}
+
+// input returns the buttons held after frame.
+func (r *RewindBuffer) input(frame int) (uint8, bool) {
+	n := frame - r.inputsFrame
+	if n < 0 || n >= len(r.inputs) {
+		return 0, false
+	}
+	return r.inputs[n], true
+}
+
+// latest drops the snapshots after frame and returns the newest one left.
+// The oldest snapshot is kept even if it is after frame.
+func (r *RewindBuffer) latest(frame int) ([]byte, int, bool) {
+	if r.newest == nil {
+		return nil, 0, false
+	}
+	for r.newestFrame > frame && len(r.deltas) > 0 {
+		d := r.deltas[len(r.deltas)-1]
+		r.deltas = r.deltas[:len(r.deltas)-1]
+		r.size -= len(d.data)
+
+		r.newest = xor(r.newest, inflate(d.data))
+		r.newestFrame = d.frame
+	}
+	return r.newest, r.newestFrame, true
+}
+
+func xor(a, b []byte) []byte {
+	if len(a) != len(b) {
+		panic(fmt.Sprintf("rewind: snapshots of %d and %d bytes", len(a), len(b)))
+	}
+	c := make([]byte, len(a))
+	for i := range a {
+		c[i] = a[i] ^ b[i]
+	}
+	return c
+}
+
+// deflate compresses b into memory, which can only fail by a mistake
+// in this file.
+func deflate(b []byte) []byte {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestSpeed)
+	if err == nil {
+		_, err = w.Write(b)
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		panic("rewind: " + err.Error())
+	}
+	return buf.Bytes()
+}
+
+// inflate undoes deflate. Like deflate, it can only fail by a mistake
+// in this file.
+func inflate(b []byte) []byte {
+	data, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(b)))
+	if err != nil {
+		panic("rewind: " + err.Error())
+	}
+	return data
+}
+
+// snapshot returns the state of the machine for the rewind buffer.
+// It panics if a field of machineState doesn't have a fixed size.
+func (gb *GB) snapshot() []byte {
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, gb.machineState()); err != nil {
+		panic("rewind: " + err.Error())
+	}
+	return buf.Bytes()
+}
+
+func (gb *GB) restore(snapshot []byte) error {
+	var s machineState
+	if err := binary.Read(bytes.NewReader(snapshot), binary.LittleEndian, &s); err != nil {
+		return err
+	}
+	gb.setMachineState(&s)
+	return nil
+}
+
+// RewindTo goes back to the end of frame, or as far as the rewind
+// buffer goes. The machine is put in the state of the newest snapshot
+// before it and runs the frames in between again without sound, with
+// the buttons that were held then. It reports whether it could go back
+// at all.
+func (gb *GB) RewindTo(frame int) bool {
+	if gb.rewind == nil || frame >= gb.frame {
+		return false
+	}
+	snapshot, at, ok := gb.rewind.latest(frame)
+	if !ok || at >= gb.frame {
+		return false
+	}
+	live := gb.Joypad.Pressed()
+	// before the restore, which also restores IF
+	gb.replayInput(at)
+	if err := gb.restore(snapshot); err != nil {
+		return false
+	}
+	gb.frame = at
+
+	gb.replaying = true
+	for gb.frame < frame {
+		gb.Step()
+	}
+	gb.replaying = false
+	// the sound of the frames run again
+	gb.APU.Flush()
+
+	// From here on the buttons are the ones held now.
+	gb.Joypad.SetPressed(live)
+	gb.rewind.record(gb.frame, live)
+	return true
+}
+
+// replayInput holds down the buttons that were held after frame.
+func (gb *GB) replayInput(frame int) {
+	if pressed, ok := gb.rewind.input(frame); ok {
+		gb.Joypad.SetPressed(pressed)
+	}
+}
@@ -0,0 +1,131 @@
+package gb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"testing"
+)
+
+// The snapshots are written with encoding/binary, which needs every
+// field of machineState to have a fixed size.
+func TestMachineStateSize(t *testing.T) {
+	if size := binary.Size(machineState{}); size <= 0 {
+		t.Errorf("binary.Size(machineState{}) = %d", size)
+	}
+}
+
+// states returns n snapshots of size bytes, each one a few bytes
+// different from the one before.
+func states(n, size int) [][]byte {
+	rnd := rand.New(rand.NewSource(1))
+	s := make([]byte, size)
+	rnd.Read(s)
+	var out [][]byte
+	for i := 0; i < n; i++ {
+		s = append([]byte(nil), s...)
+		for j := 0; j < 4; j++ {
+			s[rnd.Intn(size)]++
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func TestRewindBuffer(t *testing.T) {
+	snaps := states(4, 4096)
+	r := NewRewindBuffer(10, 1<<20)
+	for i, s := range snaps {
+		r.push(s, (i+1)*10)
+	}
+	if r.Len() != 4 {
+		t.Fatalf("Len() = %d, want 4", r.Len())
+	}
+	// The XOR of two snapshots is mostly zeros.
+	if r.Size() >= 2*4096 {
+		t.Errorf("Size() = %d, the older snapshots aren't compressed", r.Size())
+	}
+
+	tests := []struct {
+		frame int
+		want  int // index in snaps
+		len   int
+	}{
+		{45, 3, 4},
+		{40, 3, 4},
+		{25, 1, 2},
+		{20, 1, 2},
+		// the oldest one is kept
+		{5, 0, 1},
+	}
+	for _, tt := range tests {
+		s, at, ok := r.latest(tt.frame)
+		if !ok || at != (tt.want+1)*10 || !bytes.Equal(s, snaps[tt.want]) {
+			t.Errorf("latest(%d): got frame %d %t, want the snapshot of frame %d", tt.frame, at, ok, (tt.want+1)*10)
+		}
+		if r.Len() != tt.len {
+			t.Errorf("latest(%d): Len() = %d, want %d", tt.frame, r.Len(), tt.len)
+		}
+	}
+}
+
+func TestRewindBudget(t *testing.T) {
+	// random data doesn't compress, every delta takes about 1KB
+	rnd := rand.New(rand.NewSource(1))
+	var snaps [][]byte
+	for i := 0; i < 10; i++ {
+		s := make([]byte, 1024)
+		rnd.Read(s)
+		snaps = append(snaps, s)
+	}
+
+	r := NewRewindBuffer(1, 4096)
+	for i, s := range snaps {
+		r.push(s, i)
+		if r.Size() > 4096 {
+			t.Fatalf("push %d: Size() = %d, over the budget", i, r.Size())
+		}
+	}
+	if r.Len() >= len(snaps) || r.Len() < 2 {
+		t.Fatalf("Len() = %d after %d snapshots", r.Len(), len(snaps))
+	}
+
+	// the oldest ones were dropped, the ones left are still right
+	oldest := len(snaps) - r.Len()
+	s, at, ok := r.latest(0)
+	if !ok || at != oldest || !bytes.Equal(s, snaps[oldest]) {
+		t.Errorf("latest(0): got frame %d %t, want the snapshot of frame %d", at, ok, oldest)
+	}
+}
+
+func TestRewindInput(t *testing.T) {
+	r := NewRewindBuffer(1, 1<<20)
+	for frame := 10; frame < 15; frame++ {
+		r.record(frame, uint8(frame))
+	}
+	if pressed, ok := r.input(12); !ok || pressed != 12 {
+		t.Errorf("input(12) = %d %t, want 12", pressed, ok)
+	}
+	if _, ok := r.input(9); ok {
+		t.Error("input(9) is before the first recorded frame")
+	}
+
+	// Playing frame 12 again forgets what was played after it.
+	r.record(12, 0xFF)
+	if pressed, ok := r.input(12); !ok || pressed != 0xFF {
+		t.Errorf("input(12) = %02X %t after recording it again, want FF", pressed, ok)
+	}
+	if _, ok := r.input(13); ok {
+		t.Error("input(13) is still there after frame 12 was recorded again")
+	}
+
+	// The inputs before the oldest snapshot are dropped.
+	snaps := states(1, 16)
+	r.push(snaps[0], 11)
+	if _, ok := r.input(10); ok {
+		t.Error("input(10) is kept before the oldest snapshot at 11")
+	}
+	if pressed, ok := r.input(11); !ok || pressed != 11 {
+		t.Errorf("input(11) = %d %t, want 11", pressed, ok)
+	}
+}
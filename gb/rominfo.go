@@ -0,0 +1,22 @@
+package gb
+
+import (
+	"fmt"
+	"strings"
+)
+
+func (ri Rom_info) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Title:            %s\n", ri.Title)
+	fmt.Fprintf(&b, "Cartridge type:   %s\n", ri.cartridgeType)
+	fmt.Fprintf(&b, "ROM size:         %d bytes\n", ri.romSize)
+	fmt.Fprintf(&b, "RAM size:         %d bytes\n", ri.ramSize)
+	fmt.Fprintf(&b, "CGB flag:         %t\n", ri.CGBFlag)
+	fmt.Fprintf(&b, "SGB flag:         %t\n", ri.SGBFlag)
+	fmt.Fprintf(&b, "Entry point:      % X\n", ri.entryPoint)
+	fmt.Fprintf(&b, "Destination code: %02X\n", ri.destinationCode)
+	fmt.Fprintf(&b, "New licensee:     % X\n", ri.newLicenseeCode)
+	fmt.Fprintf(&b, "Old licensee:     %02X\n", ri.oldLicenseeCode)
+	fmt.Fprintf(&b, "Version:          %02X\n", ri.maskROMVersionNumber)
+	return b.String()
+}
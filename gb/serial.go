@@ -0,0 +1,41 @@
+package gb
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+func (gb *GB) captureSerial(out uint8) {
+	gb.SerialLog.WriteByte(out)
+	gb.serialUpdated = true
+
+	if gb.SerialOutput != nil {
+		if _, err := gb.SerialOutput.Write([]byte{out}); err != nil {
+			log.Println(err)
+			gb.SerialOutput = nil
+		}
+	}
+}
+
+// RunUntilSerialContains runs until one of texts has been sent over the
+// serial port and returns it, e.g. "Passed" or "Failed" from Blargg's
+// test ROMs. It gives up after maxFrames frames.
+func (gb *GB) RunUntilSerialContains(maxFrames int, texts ...string) (string, error) {
+	start := gb.frame
+	for !gb.quit && gb.frame-start < maxFrames {
+		gb.Step()
+
+		if !gb.serialUpdated {
+			continue
+		}
+		gb.serialUpdated = false
+		sent := gb.SerialLog.String()
+		for _, text := range texts {
+			if strings.Contains(sent, text) {
+				return text, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("none of %q was sent over serial in %d frames", texts, maxFrames)
+}
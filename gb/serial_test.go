@@ -0,0 +1,48 @@
+package gb
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// serialROM sends text over the serial port with the internal clock,
+// as Blargg's tests do, and then loops forever.
+func serialROM(text string) string {
+	var src strings.Builder
+	for _, c := range []byte(text) {
+		fmt.Fprintf(&src, "LD A,%d\n", c)
+		src.WriteString("LDH [$01],A\nLD A,$81\nLDH [$02],A\n")
+		src.WriteString("LDH A,[$02]\nBIT 7,A\nJR NZ,@-4\n")
+	}
+	src.WriteString("JR @\n")
+	return src.String()
+}
+
+func TestRunUntilSerialContains(t *testing.T) {
+	gb := newTestGB(t, "SERIAL", serialROM("Passed"))
+	got, err := gb.RunUntilSerialContains(60, "Failed", "Passed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "Passed" {
+		t.Errorf("got %q, want %q", got, "Passed")
+	}
+	if log := gb.SerialLog.String(); log != "Passed" {
+		t.Errorf("sent %q, want %q", log, "Passed")
+	}
+}
+
+func TestRunUntilSerialContainsTimeout(t *testing.T) {
+	gb := newTestGB(t, "SERIAL", serialROM("Pass"))
+	_, err := gb.RunUntilSerialContains(10, "Passed")
+	if err == nil {
+		t.Fatal("no error for a text which is never sent")
+	}
+	if !strings.Contains(err.Error(), "10 frames") {
+		t.Errorf("got error %q, want it to mention the 10 frames", err)
+	}
+	if gb.frame != 10 {
+		t.Errorf("gave up after %d frames, want 10", gb.frame)
+	}
+}
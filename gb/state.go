@@ -0,0 +1,194 @@
+package gb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"tgb/apu"
+	"tgb/cpu"
+	"tgb/gpu"
+	"tgb/joypad"
+	"tgb/memory"
+	"tgb/model"
+	"tgb/serial"
+	"tgb/sgb"
+	"tgb/timer"
+)
+
+// A save state file is
+//
+//	"TGBSTATE"          magic
+//	uint16 (big endian) STATE_VERSION
+//	stateHeader         gob
+//	machineState        gob
+//
+// STATE_VERSION goes up whenever machineState or one of the component
+// states changes, older states are refused.
+const (
+	STATE_MAGIC   = "TGBSTATE"
+	STATE_VERSION = 2
+)
+
+// stateHeader tells which cartridge and hardware the state belongs to.
+type stateHeader struct {
+	Title          string
+	HeaderChecksum uint8
+	GlobalChecksum uint16
+	Model          model.Model
+	CGBMode        bool
+}
+
+// machineState is the state of every component. All of its fields have
+// a fixed size, so that the rewind buffer can write it with encoding/binary
+// and compare two states byte by byte.
+type machineState struct {
+	CPU    cpu.State
+	IME    bool
+	Memory memory.State
+	Timer  timer.State
+	GPU    gpu.State
+	APU    apu.State
+	Serial serial.State
+	Joypad joypad.State
+	// zero without an SGB
+	SGB sgb.State
+
+	CurrentCycle int64
+}
+
+func (gb *GB) machineState() *machineState {
+	s := &machineState{
+		CPU:          gb.CPU.State(),
+		IME:          gb.Interrupt.IME,
+		Memory:       *gb.Memory.State(),
+		Timer:        gb.Timer.State(),
+		GPU:          *gb.GPU.State(),
+		APU:          *gb.APU.State(),
+		Serial:       gb.Serial.State(),
+		Joypad:       gb.Joypad.State(),
+		CurrentCycle: int64(gb.current_cycle),
+	}
+	if gb.SGB != nil {
+		s.SGB = *gb.SGB.State()
+	}
+	return s
+}
+
+func (gb *GB) setMachineState(s *machineState) {
+	gb.CPU.SetState(s.CPU)
+	gb.Interrupt.IME = s.IME
+	gb.Memory.SetState(&s.Memory)
+	gb.Timer.SetState(s.Timer)
+	gb.GPU.SetState(&s.GPU)
+	gb.APU.SetState(&s.APU)
+	gb.Serial.SetState(s.Serial)
+	gb.Joypad.SetState(s.Joypad)
+	if gb.SGB != nil {
+		gb.SGB.SetState(&s.SGB)
+	}
+	gb.current_cycle = int(s.CurrentCycle)
+}
+
+func (gb *GB) stateHeader() stateHeader {
+	return stateHeader{
+		Title:          gb.RomInfo.Title,
+		HeaderChecksum: gb.ROM[0x014D],
+		GlobalChecksum: uint16(gb.ROM[0x014E])<<8 | uint16(gb.ROM[0x014F]),
+		Model:          gb.Model,
+		CGBMode:        gb.CGBMode,
+	}
+}
+
+// SaveState writes the state of the whole machine to w.
+func (gb *GB) SaveState(w io.Writer) error {
+	if _, err := io.WriteString(w, STATE_MAGIC); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, uint16(STATE_VERSION)); err != nil {
+		return err
+	}
+
+	e := gob.NewEncoder(w)
+	if err := e.Encode(gb.stateHeader()); err != nil {
+		return err
+	}
+	return e.Encode(gb.machineState())
+}
+
+// LoadState restores a state written by SaveState. The state has to be
+// of the same cartridge and model, otherwise nothing is changed.
+func (gb *GB) LoadState(r io.Reader) error {
+	magic := make([]byte, len(STATE_MAGIC))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != STATE_MAGIC {
+		return errors.New("This is not a save state.")
+	}
+	var version uint16
+	if err := binary.Read(r, binary.BigEndian, &version); err != nil {
+		return err
+	}
+	if version != STATE_VERSION {
+		return fmt.Errorf("The save state is version %d, only version %d can be loaded.", version, STATE_VERSION)
+	}
+
+	d := gob.NewDecoder(r)
+	var h stateHeader
+	if err := d.Decode(&h); err != nil {
+		return err
+	}
+	if want := gb.stateHeader(); h != want {
+		if h.Title != want.Title || h.HeaderChecksum != want.HeaderChecksum || h.GlobalChecksum != want.GlobalChecksum {
+			return fmt.Errorf("The save state is of %q (checksum %04X), not of %q (checksum %04X).",
+				h.Title, h.GlobalChecksum, want.Title, want.GlobalChecksum)
+		}
+		return fmt.Errorf("The save state is for model %s, not %s.", h.Model, want.Model)
+	}
+
+	var s machineState
+	if err := d.Decode(&s); err != nil {
+		return err
+	}
+	gb.setMachineState(&s)
+	return nil
+}
+
+// StatePath returns the file of a save state slot (1-9) in
+// SaveDir, e.g. "Tetris.ss1" for roms/Tetris.gb.
+func (gb *GB) StatePath(slot int) string {
+	name := strings.TrimSuffix(filepath.Base(gb.romPath), filepath.Ext(gb.romPath))
+	return filepath.Join(gb.SaveDir, fmt.Sprintf("%s.ss%d", name, slot))
+}
+
+func (gb *GB) SaveSlot(slot int) error {
+	f, err := os.Create(gb.StatePath(slot))
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if err := gb.SaveState(w); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (gb *GB) LoadSlot(slot int) error {
+	f, err := os.Open(gb.StatePath(slot))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := gb.LoadState(bufio.NewReader(f)); err != nil {
+		return fmt.Errorf("%s: %v", gb.StatePath(slot), err)
+	}
+	return nil
+}
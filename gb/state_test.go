@@ -0,0 +1,91 @@
+package gb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// counterROM keeps counting in C000 and shows the count as the top row
+// of tile 0, which fills the background, with the timer running.
+const counterROM = `
+	LD A,$05
+	LDH [$07],A
+	LD A,$E4
+	LDH [$47],A
+	LD A,$91
+	LDH [$40],A
+Main:
+	LD HL,$C000
+	INC [HL]
+	LD A,[HL]
+	LD [$8000],A
+	JR Main`
+
+func saveState(t *testing.T, gb *GB) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := gb.SaveState(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	gb := newTestGB(t, "STATE", counterROM)
+	runFrames(gb, 3)
+
+	state := saveState(t, gb)
+	count := gb.read(0xC000)
+	regs := gb.CPU.Get()
+	timer := *gb.Timer
+	shades := gb.GPU.Shades
+
+	runFrames(gb, 2)
+	if gb.read(0xC000) == count {
+		t.Fatal("the ROM didn't count")
+	}
+
+	if err := gb.LoadState(bytes.NewReader(state)); err != nil {
+		t.Fatal(err)
+	}
+	if got := gb.read(0xC000); got != count {
+		t.Errorf("memory: got %02X, want %02X", got, count)
+	}
+	if got := gb.CPU.Get(); got != regs {
+		t.Errorf("CPU: got %s, want %s", got, regs)
+	}
+	if *gb.Timer != timer {
+		t.Errorf("timer: got %+v, want %+v", *gb.Timer, timer)
+	}
+	if gb.GPU.Shades != shades {
+		t.Error("the screen isn't the one of the saved frame")
+	}
+}
+
+func TestStateOfOtherCartridge(t *testing.T) {
+	state := saveState(t, newTestGB(t, "STATE", counterROM))
+
+	gb := newTestGB(t, "OTHER", counterROM)
+	runFrames(gb, 1)
+	count := gb.read(0xC000)
+	err := gb.LoadState(bytes.NewReader(state))
+	if err == nil || !strings.Contains(err.Error(), `"STATE"`) {
+		t.Errorf("got error %v, want one about the title", err)
+	}
+	if gb.read(0xC000) != count {
+		t.Error("the refused state was loaded")
+	}
+}
+
+func TestStateVersion(t *testing.T) {
+	gb := newTestGB(t, "STATE", counterROM)
+	state := saveState(t, gb)
+	binary.BigEndian.PutUint16(state[len(STATE_MAGIC):], STATE_VERSION+1)
+
+	err := gb.LoadState(bytes.NewReader(state))
+	if err == nil || !strings.Contains(err.Error(), "version") {
+		t.Errorf("got error %v, want one about the version", err)
+	}
+}
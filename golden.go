@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"tgb/joypad"
+	"tgb/model"
+	"tgb/runner"
+)
+
+var errGoldenMismatch = errors.New("golden: the screen differs from the golden image")
+
+func goldenCommand(args []string) error {
+	fs := flag.NewFlagSet("golden", flag.ExitOnError)
+	frames := fs.Int("frames", 60, "frames to run before the screen is compared")
+	scriptPath := fs.String("script", "", "joypad script, lines of \"<frame> <button> press|release\"")
+	modelName := fs.String("model", "auto", "hardware model: auto, dmg0, dmg, mgb, sgb, cgb or agb")
+	update := fs.Bool("update", false, "write the screen to the golden image instead of comparing")
+	diffPath := fs.String("diff", "", "where to write the diff image on a mismatch (default <golden>-diff.png)")
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("golden: expected a ROM and a PNG")
+	}
+
+	m, err := model.Parse(*modelName)
+	if err != nil {
+		return err
+	}
+	g := runner.Golden{
+		ROM:    fs.Arg(0),
+		Image:  fs.Arg(1),
+		Frames: *frames,
+		Model:  m,
+	}
+	if *scriptPath != "" {
+		f, err := os.Open(*scriptPath)
+		if err != nil {
+			return err
+		}
+		g.Script, err = joypad.ParseScript(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", *scriptPath, err)
+		}
+	}
+
+	if *update {
+		screen, err := g.Render()
+		if err != nil {
+			return err
+		}
+		if err := runner.SavePNG(g.Image, screen); err != nil {
+			return err
+		}
+		fmt.Printf("wrote %s, screen %s\n", g.Image, runner.ImageHash(screen))
+		return nil
+	}
+
+	r, err := g.Run()
+	if err != nil {
+		return err
+	}
+	if r.Diffs == 0 {
+		fmt.Printf("ok, screen %s\n", r.Hash)
+		return nil
+	}
+
+	path := *diffPath
+	if path == "" {
+		path = strings.TrimSuffix(g.Image, ".png") + "-diff.png"
+	}
+	if err := runner.SavePNG(path, r.DiffImage); err != nil {
+		return err
+	}
+	fmt.Printf("%d pixels differ, screen %s, diff written to %s\n", r.Diffs, r.Hash, path)
+	return errGoldenMismatch
+}
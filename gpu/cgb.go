@@ -0,0 +1,95 @@
+package gpu
+
+const (
+	// FF68 - BCPS/BGPI - CGB Mode Only - Background Palette Index
+	//  Bit 0-5   Index (00-3F)
+	//  Bit 7     Auto Increment  (0=Disabled, 1=Increment after Writing)
+	BCPS = 0xFF68
+	// FF69 - BCPD/BGPD - CGB Mode Only - Background Palette Data
+	BCPD = 0xFF69
+	// FF6A - OCPS/OBPI - CGB Mode Only - Sprite Palette Index
+	OCPS = 0xFF6A
+	// FF6B - OCPD/OBPD - CGB Mode Only - Sprite Palette Data
+	OCPD = 0xFF6B
+)
+
+// colorPalettes is the palette RAM of the CGB.
+// 8 palettes of 4 colors, each color takes 2 bytes:
+//
+//	Bit 0-4   Red Intensity   (00-1F)
+//	Bit 5-9   Green Intensity (00-1F)
+//	Bit 10-14 Blue Intensity  (00-1F)
+type colorPalettes struct {
+	data  [64]uint8
+	index uint8
+}
+
+func (p *colorPalettes) readIndex() uint8 {
+	return 0x40 | p.index
+}
+
+func (p *colorPalettes) writeIndex(val uint8) {
+	p.index = val & 0xBF
+}
+
+func (p *colorPalettes) readData() uint8 {
+	return p.data[p.index&0x3F]
+}
+
+func (p *colorPalettes) writeData(val uint8) {
+	p.data[p.index&0x3F] = val
+	if p.index&0x80 != 0 {
+		p.index = 0x80 | (p.index+1)&0x3F
+	}
+}
+
+// rgb15 returns color (0-3) of palette (0-7).
+func (p *colorPalettes) rgb15(palette, color uint8) uint16 {
+	i := palette*8 + color*2
+	return uint16(p.data[i]) | uint16(p.data[i+1])<<8
+}
+
+// EnableCGB maps the palette RAM and makes the GPU render in color.
+func (gpu *GPU) EnableCGB() {
+	gpu.CGB = true
+	// The boot ROM leaves the BG palettes white.
+	for i := range gpu.bgPalettes.data {
+		gpu.bgPalettes.data[i] = 0xFF
+	}
+
+	gpu.mem.HandleRead(BCPS, gpu.bgPalettes.readIndex)
+	gpu.mem.HandleWrite(BCPS, gpu.bgPalettes.writeIndex)
+	gpu.mem.HandleRead(BCPD, gpu.bgPalettes.readData)
+	gpu.mem.HandleWrite(BCPD, gpu.bgPalettes.writeData)
+	gpu.mem.HandleRead(OCPS, gpu.objPalettes.readIndex)
+	gpu.mem.HandleWrite(OCPS, gpu.objPalettes.writeIndex)
+	gpu.mem.HandleRead(OCPD, gpu.objPalettes.readData)
+	gpu.mem.HandleWrite(OCPD, gpu.objPalettes.writeData)
+	gpu.registerHDMA()
+}
+
+// toARGB converts a 15 bit color to 0xAARRGGBB.
+//
+// The CGB LCD doesn't show the colors as bright as a PC monitor
+// and mixes them a bit. With ColorCorrection, the colors are
+// adjusted as Gambatte does so that the games look as intended.
+func (gpu *GPU) toARGB(rgb uint16) uint32 {
+	r := uint32(rgb & 0x1F)
+	g := uint32(rgb >> 5 & 0x1F)
+	b := uint32(rgb >> 10 & 0x1F)
+
+	if gpu.ColorCorrection {
+		r, g, b = (r*13+g*2+b)>>1, (g*3+b)<<1, (r*3+g*2+b*11)>>1
+	} else {
+		r, g, b = r<<3|r>>2, g<<3|g>>2, b<<3|b>>2
+	}
+	return 0xFF000000 | r<<16 | g<<8 | b
+}
+
+func (gpu *GPU) bgColor(palette, color uint8) uint32 {
+	return gpu.toARGB(gpu.bgPalettes.rgb15(palette, color))
+}
+
+func (gpu *GPU) objColor(palette, color uint8) uint32 {
+	return gpu.toARGB(gpu.objPalettes.rgb15(palette, color))
+}
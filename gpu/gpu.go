@@ -1,6 +1,9 @@
 package gpu
 
 import (
+	"tgb/interrupt"
+	"tgb/memory"
+
 	"github.com/veandco/go-sdl2/sdl"
 )
 
@@ -18,21 +21,76 @@ const (
 
 	LCDC = 0xFF40
 	STAT = 0xFF41
+
+	SCREEN_WIDTH  = winWidth
+	SCREEN_HEIGHT = winHeight
+
+	// The SGB shows a 256x224 picture with the screen at (48, 40).
+	SGB_WIDTH    = 256
+	SGB_HEIGHT   = 224
+	SGB_SCREEN_X = 48
+	SGB_SCREEN_Y = 40
 )
 
+// The 4 shades of the DMG, from lightest to darkest.
+var Palettes = map[string][4]uint32{
+	"gray":   {WHITE, LIGHT_GLAY, DARK_GLAY, BLACH},
+	"green":  {0xFF9BBC0F, 0xFF8BAC0F, 0xFF306230, 0xFF0F380F},
+	"pocket": {0xFFC4CFA1, 0xFF8B956D, 0xFF4D533C, 0xFF1F1F1F},
+}
+
 type GPU struct {
 	Screen [winWidth][winHeight][4]int
+	// Shade (0-3) of every pixel after BGP/OBP0/OBP1, for the SGB to colorize
+	Shades [winWidth][winHeight]uint8
+	// SGBFrame, if set, is shown on the window instead of Screen
+	SGBFrame *[SGB_WIDTH][SGB_HEIGHT]uint32
 	BackGround [256][256][4]int
 	Title string
 
+	// Size of a Game Boy pixel on the window
+	Scale int32
+	Palette [4]uint32
+
 	Window *sdl.Window
 	Surface *sdl.Surface
+
+	// CGB mode: colors come from the palette RAM instead of Palette
+	CGB bool
+	// Adjust the CGB colors to look like on the real LCD
+	ColorCorrection bool
+	bgPalettes  colorPalettes
+	objPalettes colorPalettes
+	hdma        hdma
+	// clocks the CPU waits for the VRAM DMA
+	dmaStall int
+
+	mode uint8
+	// clocks since the start of the current line
+	dots int
+	ly   uint8
+	// STAT bit 3-6
+	stat uint8
+	dma  uint8
+	// line of the window to draw next, it only advances while the window is visible
+	windowLine int
+	lcdOff     bool
+
+	mem *memory.Memory
+	irq *interrupt.Interrupt
 }
 
-func New() *GPU {
-	return &GPU{
+func New(mem *memory.Memory, irq *interrupt.Interrupt) *GPU {
+	gpu := &GPU{
 		Title: "test",
+		Scale: PIXEL_SIZE,
+		Palette: Palettes["gray"],
+		mode: MODE_OAM,
+		mem: mem,
+		irq: irq,
 	}
+	gpu.registerIO()
+	return gpu
 }
 
 func (gpu *GPU) Init() {
@@ -44,8 +102,8 @@ func (gpu *GPU) Init() {
 		gpu.Title,
 		sdl.WINDOWPOS_UNDEFINED,
 		sdl.WINDOWPOS_UNDEFINED,
-		winWidth * PIXEL_SIZE,
-		winHeight * PIXEL_SIZE,
+		gpu.width() * gpu.Scale,
+		gpu.height() * gpu.Scale,
 		sdl.WINDOW_SHOWN,
 	)
 	if err != nil {
@@ -60,6 +118,13 @@ func (gpu *GPU) Init() {
 	}
 
 	gpu.Surface = surface
+
+	// The LCD shows the lightest shade until the game draws something.
+	for x := 0; x < winWidth; x++ {
+		for y := 0; y < winHeight; y++ {
+			gpu.setPixel(x, y, gpu.Palette[0])
+		}
+	}
 }
 
 func (gpu *GPU) LCDC() {
@@ -89,14 +154,37 @@ func (gpu *GPU) LCDC() {
 	//  1: on
 }
 
+func (gpu *GPU) width() int32 {
+	if gpu.SGBFrame != nil {
+		return SGB_WIDTH
+	}
+	return winWidth
+}
+
+func (gpu *GPU) height() int32 {
+	if gpu.SGBFrame != nil {
+		return SGB_HEIGHT
+	}
+	return winHeight
+}
+
 func (gpu *GPU) RenderScreen() {
+	// headless
+	if gpu.Window == nil {
+		return
+	}
+	if gpu.SGBFrame != nil {
+		gpu.renderSGBFrame()
+		return
+	}
+
 	for x := 0; x < winWidth; x++ {
 		for y := 0; y < winHeight; y++ {
 			rect := sdl.Rect{
-				X: int32(x) * PIXEL_SIZE,
-				Y: int32(y) * PIXEL_SIZE,
-				W: PIXEL_SIZE,
-				H: PIXEL_SIZE,
+				X: int32(x) * gpu.Scale,
+				Y: int32(y) * gpu.Scale,
+				W: gpu.Scale,
+				H: gpu.Scale,
 			}
 			gpu.Surface.FillRect(&rect, toColor(gpu.Screen[x][y]))
 		}
@@ -104,8 +192,39 @@ func (gpu *GPU) RenderScreen() {
 	gpu.Window.UpdateSurface()
 }
 
-func (gpu *GPU) UpdateGraphics(cycles int) {
-	gpu.RenderScreen()
+func (gpu *GPU) renderSGBFrame() {
+	for x := 0; x < SGB_WIDTH; x++ {
+		for y := 0; y < SGB_HEIGHT; y++ {
+			rect := sdl.Rect{
+				X: int32(x) * gpu.Scale,
+				Y: int32(y) * gpu.Scale,
+				W: gpu.Scale,
+				H: gpu.Scale,
+			}
+			gpu.Surface.FillRect(&rect, gpu.SGBFrame[x][y])
+		}
+	}
+	gpu.Window.UpdateSurface()
+}
+
+// setShade draws a pixel of the DMG palette.
+func (gpu *GPU) setShade(x, y int, shade uint8) {
+	gpu.Shades[x][y] = shade
+	gpu.setPixel(x, y, gpu.Palette[shade])
+}
+
+func (gpu *GPU) setPixel(x, y int, color uint32) {
+	gpu.Screen[x][y] = [4]int{
+		int(color & 0xFF),
+		int(color >> 8 & 0xFF),
+		int(color >> 16 & 0xFF),
+		int(color >> 24 & 0xFF),
+	}
+}
+
+// Pixel returns the color (0xAARRGGBB) of the screen at (x, y).
+func (gpu *GPU) Pixel(x, y int) uint32 {
+	return toColor(gpu.Screen[x][y])
 }
 
 func toColor(scrn [4]int) uint32 {
@@ -0,0 +1,111 @@
+package gpu
+
+const (
+	// FF51 - HDMA1 - CGB Mode Only - New DMA Source, High
+	// FF52 - HDMA2 - CGB Mode Only - New DMA Source, Low
+	//   The lower 4 bits are ignored.
+	HDMA1 = 0xFF51
+	HDMA2 = 0xFF52
+	// FF53 - HDMA3 - CGB Mode Only - New DMA Destination, High
+	// FF54 - HDMA4 - CGB Mode Only - New DMA Destination, Low
+	//   Only bits 12-4 are used, the destination is always in VRAM.
+	HDMA3 = 0xFF53
+	HDMA4 = 0xFF54
+	// FF55 - HDMA5 - CGB Mode Only - New DMA Length/Mode/Start
+	//   Bit 7   - Transfer Mode (0=General Purpose DMA, 1=H-Blank DMA)
+	//   Bit 6-0 - Length/10h-1 (i.e. 00h..7Fh = 10h..800h bytes)
+	HDMA5 = 0xFF55
+
+	// The CPU is halted while 16 bytes are copied.
+	CYCLES_HDMA_BLOCK = 32
+)
+
+type hdma struct {
+	regs [4]uint8 // HDMA1-HDMA4
+	src  uint16
+	dst  uint16
+	// 16 byte blocks left to copy
+	blocks int
+	// H-Blank DMA in progress
+	active bool
+}
+
+func (gpu *GPU) registerHDMA() {
+	for i := uint16(0); i < 4; i++ {
+		i := i
+		// HDMA1-HDMA4 are write only.
+		gpu.mem.HandleRead(HDMA1+i, func() uint8 { return 0xFF })
+		gpu.mem.HandleWrite(HDMA1+i, func(val uint8) { gpu.hdma.regs[i] = val })
+	}
+	gpu.mem.HandleRead(HDMA5, gpu.readHDMA5)
+	gpu.mem.HandleWrite(HDMA5, gpu.writeHDMA5)
+}
+
+// Reading HDMA5 returns FFh when no transfer is left,
+// the remaining length with Bit 7 cleared while H-Blank DMA is active
+// and with Bit 7 set after it was stopped.
+func (gpu *GPU) readHDMA5() uint8 {
+	h := &gpu.hdma
+	if h.blocks == 0 {
+		return 0xFF
+	}
+	val := uint8(h.blocks-1) & 0x7F
+	if !h.active {
+		val |= 0x80
+	}
+	return val
+}
+
+func (gpu *GPU) writeHDMA5(val uint8) {
+	h := &gpu.hdma
+
+	// Writing Bit 7 = 0 during H-Blank DMA stops it.
+	if h.active && val&0x80 == 0 {
+		h.active = false
+		return
+	}
+
+	h.src = (uint16(h.regs[0])<<8 | uint16(h.regs[1])) & 0xFFF0
+	h.dst = (uint16(h.regs[2])<<8 | uint16(h.regs[3])) & 0x1FF0
+	h.blocks = int(val&0x7F) + 1
+
+	if val&0x80 != 0 {
+		h.active = true
+		return
+	}
+
+	// General Purpose DMA copies everything at once.
+	for h.blocks > 0 {
+		gpu.copyHDMABlock()
+	}
+}
+
+// hblankDMA copies the next 16 bytes at the start of each H-Blank.
+func (gpu *GPU) hblankDMA() {
+	if !gpu.hdma.active {
+		return
+	}
+	gpu.copyHDMABlock()
+	if gpu.hdma.blocks == 0 {
+		gpu.hdma.active = false
+	}
+}
+
+func (gpu *GPU) copyHDMABlock() {
+	h := &gpu.hdma
+	for i := uint16(0); i < 0x10; i++ {
+		gpu.write(0x8000|(h.dst+i)&0x1FFF, gpu.read(h.src+i))
+	}
+	h.src += 0x10
+	h.dst = (h.dst + 0x10) & 0x1FF0
+	h.blocks--
+	gpu.dmaStall += CYCLES_HDMA_BLOCK
+}
+
+// TakeDMAStall returns the clock cycles the CPU has to wait for
+// the VRAM DMA since the last call.
+func (gpu *GPU) TakeDMAStall() int {
+	stall := gpu.dmaStall
+	gpu.dmaStall = 0
+	return stall
+}
@@ -0,0 +1,389 @@
+package gpu
+
+import (
+	"sort"
+)
+
+const (
+	SCY  = 0xFF42 // Scroll Y (R/W)
+	SCX  = 0xFF43 // Scroll X (R/W)
+	LY   = 0xFF44 // LCDC Y-Coordinate (R)
+	LYC  = 0xFF45 // LY Compare (R/W)
+	DMA  = 0xFF46 // DMA Transfer and Start Address (W)
+	BGP  = 0xFF47 // BG Palette Data (R/W)
+	OBP0 = 0xFF48 // Object Palette 0 Data (R/W)
+	OBP1 = 0xFF49 // Object Palette 1 Data (R/W)
+	WY   = 0xFF4A // Window Y Position (R/W)
+	WX   = 0xFF4B // Window X Position minus 7 (R/W)
+
+	OAM = 0xFE00
+
+	// STAT Bit 1-0 - Mode Flag
+	MODE_HBLANK   = 0
+	MODE_VBLANK   = 1
+	MODE_OAM      = 2
+	MODE_TRANSFER = 3
+
+	CYCLES_OAM      = 80
+	CYCLES_TRANSFER = 172
+	CYCLES_LINE     = 456
+	LINES_FRAME     = 154
+)
+
+// STAT - LCDC Status (R/W)
+//
+//	Bit 6 - LYC=LY Coincidence Interrupt (1=Enable) (Read/Write)
+//	Bit 5 - Mode 2 OAM Interrupt         (1=Enable) (Read/Write)
+//	Bit 4 - Mode 1 V-Blank Interrupt     (1=Enable) (Read/Write)
+//	Bit 3 - Mode 0 H-Blank Interrupt     (1=Enable) (Read/Write)
+//	Bit 2 - Coincidence Flag  (0:LYC<>LY, 1:LYC=LY) (Read Only)
+//	Bit 1-0 - Mode Flag       (Mode 0-3)            (Read Only)
+func (gpu *GPU) readSTAT() uint8 {
+	stat := 0x80 | gpu.stat&0x78 | gpu.mode
+	if gpu.ly == gpu.read(LYC) {
+		stat |= 0x04
+	}
+	return stat
+}
+
+func (gpu *GPU) writeSTAT(val uint8) {
+	gpu.stat = val & 0x78
+}
+
+// Writing to DMA copies 160 bytes from XX00-XX9F to the OAM.
+func (gpu *GPU) writeDMA(val uint8) {
+	gpu.dma = val
+	src := uint16(val) << 8
+	for i := uint16(0); i < 0xA0; i++ {
+		gpu.write(OAM+i, gpu.read(src+i))
+	}
+}
+
+func (gpu *GPU) registerIO() {
+	gpu.mem.HandleRead(STAT, gpu.readSTAT)
+	gpu.mem.HandleWrite(STAT, gpu.writeSTAT)
+	gpu.mem.HandleRead(LY, func() uint8 { return gpu.ly })
+	// LY is read only
+	gpu.mem.HandleWrite(LY, func(uint8) {})
+	gpu.mem.HandleRead(DMA, func() uint8 { return gpu.dma })
+	gpu.mem.HandleWrite(DMA, gpu.writeDMA)
+}
+
+func (gpu *GPU) UpdateGraphics(cycles int) {
+	// LCD off: LY stays 0 and no interrupts are requested.
+	if gpu.read(LCDC)&0x80 == 0 {
+		gpu.ly = 0
+		gpu.dots = 0
+		gpu.mode = MODE_HBLANK
+		gpu.windowLine = 0
+		gpu.lcdOff = true
+		return
+	}
+	// Turning the LCD on starts a new frame from line 0.
+	if gpu.lcdOff {
+		gpu.lcdOff = false
+		gpu.mode = MODE_OAM
+	}
+
+	gpu.dots += cycles
+	for {
+		switch gpu.mode {
+		case MODE_OAM:
+			if gpu.dots < CYCLES_OAM {
+				return
+			}
+			gpu.setMode(MODE_TRANSFER)
+
+		case MODE_TRANSFER:
+			if gpu.dots < CYCLES_OAM+CYCLES_TRANSFER {
+				return
+			}
+			gpu.renderScanline()
+			gpu.setMode(MODE_HBLANK)
+			gpu.hblankDMA()
+
+		case MODE_HBLANK:
+			if gpu.dots < CYCLES_LINE {
+				return
+			}
+			gpu.dots -= CYCLES_LINE
+			gpu.setLY(gpu.ly + 1)
+			if gpu.ly == winHeight {
+				gpu.setMode(MODE_VBLANK)
+				gpu.irq.SetIF_VBlankFlag()
+			} else {
+				gpu.setMode(MODE_OAM)
+			}
+
+		case MODE_VBLANK:
+			if gpu.dots < CYCLES_LINE {
+				return
+			}
+			gpu.dots -= CYCLES_LINE
+			if gpu.ly+1 == LINES_FRAME {
+				gpu.windowLine = 0
+				gpu.setLY(0)
+				gpu.setMode(MODE_OAM)
+			} else {
+				gpu.setLY(gpu.ly + 1)
+			}
+		}
+	}
+}
+
+func (gpu *GPU) setMode(mode uint8) {
+	gpu.mode = mode
+
+	var enable uint8
+	switch mode {
+	case MODE_HBLANK:
+		enable = 0x08
+	case MODE_VBLANK:
+		enable = 0x10
+	case MODE_OAM:
+		enable = 0x20
+	}
+	if gpu.stat&enable != 0 {
+		gpu.irq.SetIF_LCDFlag()
+	}
+}
+
+func (gpu *GPU) setLY(ly uint8) {
+	gpu.ly = ly
+	if gpu.ly == gpu.read(LYC) && gpu.stat&0x40 != 0 {
+		gpu.irq.SetIF_LCDFlag()
+	}
+}
+
+func (gpu *GPU) renderScanline() {
+	lcdc := gpu.read(LCDC)
+	y := int(gpu.ly)
+
+	// Color number (0-3) of the BG/Window before the palette is applied
+	// and the BG-to-OAM Priority of its tile.
+	// OBJ behind the BG are only drawn over color 0.
+	var line bgLine
+
+	// In CGB mode, LCDC Bit 0 doesn't turn the BG off but
+	// takes the priority away from it.
+	if lcdc&0x01 != 0 || gpu.CGB {
+		gpu.renderBackground(lcdc, y, &line)
+		gpu.renderWindow(lcdc, y, &line)
+	} else {
+		for x := 0; x < winWidth; x++ {
+			gpu.setShade(x, y, 0)
+		}
+	}
+
+	if lcdc&0x02 != 0 {
+		gpu.renderSprites(lcdc, y, &line)
+	}
+}
+
+type bgLine struct {
+	color    [winWidth]uint8
+	priority [winWidth]bool
+}
+
+func (gpu *GPU) renderBackground(lcdc uint8, y int, line *bgLine) {
+	mapBase := uint16(0x9800)
+	if lcdc&0x08 != 0 {
+		mapBase = 0x9C00
+	}
+	scx := int(gpu.read(SCX))
+	by := (y + int(gpu.read(SCY))) & 0xFF
+
+	for x := 0; x < winWidth; x++ {
+		bx := (x + scx) & 0xFF
+		gpu.renderBGPixel(lcdc, mapBase, bx, by, x, y, line)
+	}
+}
+
+func (gpu *GPU) renderWindow(lcdc uint8, y int, line *bgLine) {
+	wy := int(gpu.read(WY))
+	wx := int(gpu.read(WX)) - 7
+	if lcdc&0x20 == 0 || y < wy || wx >= winWidth {
+		return
+	}
+
+	mapBase := uint16(0x9800)
+	if lcdc&0x40 != 0 {
+		mapBase = 0x9C00
+	}
+	wl := gpu.windowLine
+
+	for x := wx; x < winWidth; x++ {
+		if x < 0 {
+			continue
+		}
+		gpu.renderBGPixel(lcdc, mapBase, x-wx, wl, x, y, line)
+	}
+	gpu.windowLine++
+}
+
+// renderBGPixel draws the pixel (mx, my) of a tile map at (x, y) of the screen.
+//
+// In CGB mode, the BG Map Attributes are at the same address in VRAM bank 1.
+//
+//	Bit 0-2  Background Palette number  (BGP0-7)
+//	Bit 3    Tile VRAM Bank number      (0=Bank 0, 1=Bank 1)
+//	Bit 5    Horizontal Flip            (0=Normal, 1=Mirror horizontally)
+//	Bit 6    Vertical Flip              (0=Normal, 1=Mirror vertically)
+//	Bit 7    BG-to-OAM Priority         (0=Use OAM priority bit, 1=BG Priority)
+func (gpu *GPU) renderBGPixel(lcdc uint8, mapBase uint16, mx, my, x, y int, line *bgLine) {
+	mapAddr := mapBase + uint16(my/8*32+mx/8)
+	tile := gpu.mem.ReadVRAM(0, mapAddr)
+	px, py := mx%8, my%8
+
+	if !gpu.CGB {
+		color := gpu.tileColor(lcdc, 0, tile, px, py)
+		line.color[x] = color
+		gpu.setShade(x, y, shade(gpu.read(BGP), color))
+		return
+	}
+
+	attr := gpu.mem.ReadVRAM(1, mapAddr)
+	if attr&0x20 != 0 {
+		px = 7 - px
+	}
+	if attr&0x40 != 0 {
+		py = 7 - py
+	}
+	color := gpu.tileColor(lcdc, attr>>3&0x01, tile, px, py)
+	line.color[x] = color
+	line.priority[x] = attr&0x80 != 0
+	gpu.setPixel(x, y, gpu.bgColor(attr&0x07, color))
+}
+
+type sprite struct {
+	y, x  int
+	tile  uint8
+	attr  uint8
+	index int
+}
+
+// OAM entry
+//
+//	Byte0 - Y Position (minus 16)
+//	Byte1 - X Position (minus 8)
+//	Byte2 - Tile/Pattern Number
+//	Byte3 - Attributes/Flags:
+//	  Bit7   OBJ-to-BG Priority (0=OBJ Above BG, 1=OBJ Behind BG color 1-3)
+//	  Bit6   Y flip
+//	  Bit5   X flip
+//	  Bit4   Palette number  **Non CGB Mode Only** (0=OBP0, 1=OBP1)
+//	  Bit3   Tile VRAM-Bank  **CGB Mode Only**     (0=Bank 0, 1=Bank 1)
+//	  Bit2-0 Palette number  **CGB Mode Only**     (OBP0-7)
+func (gpu *GPU) renderSprites(lcdc uint8, y int, line *bgLine) {
+	height := 8
+	if lcdc&0x04 != 0 {
+		height = 16
+	}
+
+	// At most 10 sprites per line, in OAM order.
+	var sprites []sprite
+	for i := 0; i < 40 && len(sprites) < 10; i++ {
+		addr := OAM + uint16(i*4)
+		sy := int(gpu.read(addr)) - 16
+		if y < sy || sy+height <= y {
+			continue
+		}
+		sprites = append(sprites, sprite{
+			y:     sy,
+			x:     int(gpu.read(addr+1)) - 8,
+			tile:  gpu.read(addr + 2),
+			attr:  gpu.read(addr + 3),
+			index: i,
+		})
+	}
+
+	// The sprite with the smaller X (then the smaller OAM index) wins,
+	// so draw it last. In CGB mode only the OAM index counts.
+	sort.Slice(sprites, func(i, j int) bool {
+		if sprites[i].x != sprites[j].x && !gpu.CGB {
+			return sprites[i].x > sprites[j].x
+		}
+		return sprites[i].index > sprites[j].index
+	})
+
+	// CGB: with LCDC Bit 0 off, sprites are always drawn over the BG.
+	bgPriority := !gpu.CGB || lcdc&0x01 != 0
+
+	for _, s := range sprites {
+		row := y - s.y
+		if s.attr&0x40 != 0 {
+			row = height - 1 - row
+		}
+		tile := s.tile
+		if height == 16 {
+			tile &= 0xFE
+		}
+		var bank uint8
+		if gpu.CGB {
+			bank = s.attr >> 3 & 0x01
+		}
+		palette := gpu.read(OBP0)
+		if s.attr&0x10 != 0 {
+			palette = gpu.read(OBP1)
+		}
+
+		for px := 0; px < 8; px++ {
+			x := s.x + px
+			if x < 0 || winWidth <= x {
+				continue
+			}
+			col := px
+			if s.attr&0x20 != 0 {
+				col = 7 - px
+			}
+			color := gpu.tileDataColor(bank, 0x8000+uint16(tile)*16, col, row)
+			if color == 0 {
+				continue
+			}
+			behind := s.attr&0x80 != 0 || line.priority[x]
+			if bgPriority && behind && line.color[x] != 0 {
+				continue
+			}
+			if gpu.CGB {
+				gpu.setPixel(x, y, gpu.objColor(s.attr&0x07, color))
+			} else {
+				gpu.setShade(x, y, shade(palette, color))
+			}
+		}
+	}
+}
+
+// tileColor returns the color number of a BG/Window tile pixel.
+// LCDC Bit 4 selects 8000-8FFF (unsigned tile numbers)
+// or 8800-97FF (signed tile numbers around 9000).
+func (gpu *GPU) tileColor(lcdc uint8, bank uint8, tile uint8, x, y int) uint8 {
+	var addr uint16
+	if lcdc&0x10 != 0 {
+		addr = 0x8000 + uint16(tile)*16
+	} else {
+		addr = uint16(0x9000 + int(int8(tile))*16)
+	}
+	return gpu.tileDataColor(bank, addr, x, y)
+}
+
+// Each tile row is 2 bytes, the first holds bit 0 and the
+// second bit 1 of the color number. Bit 7 is the leftmost pixel.
+func (gpu *GPU) tileDataColor(bank uint8, addr uint16, x, y int) uint8 {
+	lo := gpu.mem.ReadVRAM(bank, addr+uint16(y*2))
+	hi := gpu.mem.ReadVRAM(bank, addr+uint16(y*2)+1)
+	bit := uint(7 - x)
+	return (hi>>bit&0x01)<<1 | lo>>bit&0x01
+}
+
+// shade maps a color number through BGP/OBP0/OBP1.
+func shade(palette uint8, color uint8) uint8 {
+	return palette >> (color * 2) & 0x03
+}
+
+func (gpu *GPU) read(addr uint16) uint8 {
+	return gpu.mem.Read(addr)
+}
+
+func (gpu *GPU) write(addr uint16, val uint8) {
+	gpu.mem.Write(addr, val)
+}
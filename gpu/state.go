@@ -0,0 +1,86 @@
+package gpu
+
+// State is what a save state keeps of the GPU. The screen is kept
+// so that it doesn't go blank until the next frame is drawn.
+type State struct {
+	// 0xAARRGGBB of every pixel
+	Screen [winWidth][winHeight]uint32
+	Shades [winWidth][winHeight]uint8
+
+	BGPalettes      [64]uint8
+	BGPaletteIndex  uint8
+	ObjPalettes     [64]uint8
+	ObjPaletteIndex uint8
+
+	HDMARegs   [4]uint8
+	HDMASrc    uint16
+	HDMADst    uint16
+	HDMABlocks int64
+	HDMAActive bool
+	DMAStall   int64
+
+	Mode       uint8
+	Dots       int64
+	LY         uint8
+	STAT       uint8
+	DMA        uint8
+	WindowLine int64
+	LCDOff     bool
+}
+
+func (gpu *GPU) State() *State {
+	s := &State{
+		Shades:          gpu.Shades,
+		BGPalettes:      gpu.bgPalettes.data,
+		BGPaletteIndex:  gpu.bgPalettes.index,
+		ObjPalettes:     gpu.objPalettes.data,
+		ObjPaletteIndex: gpu.objPalettes.index,
+		HDMARegs:        gpu.hdma.regs,
+		HDMASrc:         gpu.hdma.src,
+		HDMADst:         gpu.hdma.dst,
+		HDMABlocks:      int64(gpu.hdma.blocks),
+		HDMAActive:      gpu.hdma.active,
+		DMAStall:        int64(gpu.dmaStall),
+		Mode:            gpu.mode,
+		Dots:            int64(gpu.dots),
+		LY:              gpu.ly,
+		STAT:            gpu.stat,
+		DMA:             gpu.dma,
+		WindowLine:      int64(gpu.windowLine),
+		LCDOff:          gpu.lcdOff,
+	}
+	for x := range s.Screen {
+		for y := range s.Screen[x] {
+			s.Screen[x][y] = gpu.Pixel(x, y)
+		}
+	}
+	return s
+}
+
+func (gpu *GPU) SetState(s *State) {
+	for x := range s.Screen {
+		for y := range s.Screen[x] {
+			gpu.setPixel(x, y, s.Screen[x][y])
+		}
+	}
+	gpu.Shades = s.Shades
+	gpu.bgPalettes.data = s.BGPalettes
+	gpu.bgPalettes.index = s.BGPaletteIndex
+	gpu.objPalettes.data = s.ObjPalettes
+	gpu.objPalettes.index = s.ObjPaletteIndex
+	gpu.hdma = hdma{
+		regs:   s.HDMARegs,
+		src:    s.HDMASrc,
+		dst:    s.HDMADst,
+		blocks: int(s.HDMABlocks),
+		active: s.HDMAActive,
+	}
+	gpu.dmaStall = int(s.DMAStall)
+	gpu.mode = s.Mode
+	gpu.dots = int(s.Dots)
+	gpu.ly = s.LY
+	gpu.stat = s.STAT
+	gpu.dma = s.DMA
+	gpu.windowLine = int(s.WindowLine)
+	gpu.lcdOff = s.LCDOff
+}
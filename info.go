@@ -0,0 +1,30 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"tgb/gb"
+)
+
+func infoCommand(args []string) error {
+	fs := flag.NewFlagSet("info", flag.ExitOnError)
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("info: expected a ROM")
+	}
+
+	for _, filename := range fs.Args() {
+		ri, err := gb.ReadRomInfo(filename)
+		if err != nil {
+			return err
+		}
+		if fs.NArg() > 1 {
+			fmt.Printf("%s:\n", filename)
+		}
+		fmt.Print(ri)
+	}
+	return nil
+}
@@ -4,11 +4,6 @@ import (
 	"tgb/memory"
 )
 
-// Interrupt Master Enable Flag
-// false - Disable all Interrupts
-// true - Enable all Interrupts that are enabled in IE Register (FFFF)
-var IME bool
-
 const (
 	// FFFF - IE - Interrupt Enable (R/W)
 	//  Bit 0: V-Blank  Interrupt Enable  (INT 40h)  (1=Enable)
@@ -27,81 +22,96 @@ const (
 	IF = 0xFF0F
 )
 
-func DoInterrupt() {
+type Interrupt struct {
+	// Interrupt Master Enable Flag
+	// false - Disable all Interrupts
+	// true - Enable all Interrupts that are enabled in IE Register (FFFF)
+	IME bool
 
+	mem *memory.Memory
 }
 
-func SetIMEFlag() {
-	IME = true
+func New(mem *memory.Memory) *Interrupt {
+	return &Interrupt{mem: mem}
 }
 
-func ClearIMEFlag() {
-	IME = false
+func (i *Interrupt) SetIMEFlag() {
+	i.IME = true
 }
 
-func CheckInterruptVector() {
-
+func (i *Interrupt) ClearIMEFlag() {
+	i.IME = false
 }
 
-func CheckInterrupts() bool {
-	if isAllSet(read(IE)) && isAllSet(read(IF)) && IME == true {
-		return true
-	}
-	return false
+// Pending returns the interrupts that are requested in IF and enabled in IE.
+// A halted CPU wakes up on them even if IME is '0'.
+func (i *Interrupt) Pending() uint8 {
+	return i.read(IE) & i.read(IF) & 0x1F
 }
 
-func isAllSet(flag uint8) bool {
-	return 0xFF == flag
+// CheckInterruptVector acknowledges the pending interrupt with the
+// highest priority, bit 0 (V-Blank) first: its IF bit and IME are cleared.
+// It returns the address of the handler, 40h + 8 * bit.
+func (i *Interrupt) CheckInterruptVector() uint16 {
+	pending := i.Pending()
+	for bit := uint(0); bit < 5; bit++ {
+		if pending&(1<<bit) != 0 {
+			i.write(IF, i.read(IF)&^(1<<bit))
+			i.IME = false
+			return 0x40 + 8*uint16(bit)
+		}
+	}
+	return 0
 }
 
-func DoInterrupts() {
-
+func (i *Interrupt) CheckInterrupts() bool {
+	return i.IME && i.Pending() != 0
 }
 
-func write(addr uint16, val uint8) {
-	memory.Write(addr, val)
+func (i *Interrupt) write(addr uint16, val uint8) {
+	i.mem.Write(addr, val)
 }
 
-func read(addr uint16) uint8 {
-	return memory.Read(addr)
+func (i *Interrupt) read(addr uint16) uint8 {
+	return i.mem.Read(addr)
 }
 
-func SetIF_VBlankFlag() {
-	write(IF, read(IF) | 0x01)
+func (i *Interrupt) SetIF_VBlankFlag() {
+	i.write(IF, i.read(IF) | 0x01)
 }
 
-func SetIF_LCDFlag() {
-	write(IF, read(IF) | 0x02)
+func (i *Interrupt) SetIF_LCDFlag() {
+	i.write(IF, i.read(IF) | 0x02)
 }
 
-func SetIF_TimerFlag() {
-	write(IF, read(IF) | 0x04)
+func (i *Interrupt) SetIF_TimerFlag() {
+	i.write(IF, i.read(IF) | 0x04)
 }
 
-func SetIF_SerialFlag() {
-	write(IF, read(IF) | 0x08)
+func (i *Interrupt) SetIF_SerialFlag() {
+	i.write(IF, i.read(IF) | 0x08)
 }
 
-func SetIF_JoypadFlag() {
-	write(IF, read(IF) | 0x10)
+func (i *Interrupt) SetIF_JoypadFlag() {
+	i.write(IF, i.read(IF) | 0x10)
 }
 
-func ClearIF_VBlankFlag() {
-	write(IF, read(IF) & 0xFE)
+func (i *Interrupt) ClearIF_VBlankFlag() {
+	i.write(IF, i.read(IF) & 0xFE)
 }
 
-func ClearIF_LCDFlag() {
-	write(IF, read(IF) & 0xFD)
+func (i *Interrupt) ClearIF_LCDFlag() {
+	i.write(IF, i.read(IF) & 0xFD)
 }
 
-func ClearIF_TimerFlag() {
-	write(IF, read(IF) & 0xFB)
+func (i *Interrupt) ClearIF_TimerFlag() {
+	i.write(IF, i.read(IF) & 0xFB)
 }
 
-func ClearIF_SerialFlag() {
-	write(IF, read(IF) & 0xF7)
+func (i *Interrupt) ClearIF_SerialFlag() {
+	i.write(IF, i.read(IF) & 0xF7)
 }
 
-func ClearIF_JoypadFlag() {
-	write(IF, read(IF) & 0xEF)
+func (i *Interrupt) ClearIF_JoypadFlag() {
+	i.write(IF, i.read(IF) & 0xEF)
 }
\ No newline at end of file
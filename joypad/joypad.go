@@ -0,0 +1,142 @@
+package joypad
+
+import (
+	"tgb/interrupt"
+	"tgb/memory"
+)
+
+const (
+	// FF00 - P1/JOYP - Joypad (R/W)
+	//  Bit 7 - Not used
+	//  Bit 6 - Not used
+	//  Bit 5 - P15 Select Action buttons    (0=Select)
+	//  Bit 4 - P14 Select Direction buttons (0=Select)
+	//  Bit 3 - P13 Input: Down  or Start    (0=Pressed) (Read Only)
+	//  Bit 2 - P12 Input: Up    or Select   (0=Pressed) (Read Only)
+	//  Bit 1 - P11 Input: Left  or B        (0=Pressed) (Read Only)
+	//  Bit 0 - P10 Input: Right or A        (0=Pressed) (Read Only)
+	P1 = 0xFF00
+)
+
+type Button int
+
+const (
+	Right Button = iota
+	Left
+	Up
+	Down
+	A
+	B
+	Select
+	Start
+)
+
+var buttonNames = map[Button]string{
+	Right:  "Right",
+	Left:   "Left",
+	Up:     "Up",
+	Down:   "Down",
+	A:      "A",
+	B:      "B",
+	Select: "Select",
+	Start:  "Start",
+}
+
+func (b Button) String() string {
+	return buttonNames[b]
+}
+
+// Input is anything that can push buttons: the SDL frontend, a script, ...
+type Input interface {
+	Press(b Button)
+	Release(b Button)
+}
+
+type Joypad struct {
+	// bit n is set while Button(n) is held down
+	pressed uint8
+
+	// P14/P15 as written by the game
+	sel uint8
+
+	// OnWrite, if set, is called with every value written to P1.
+	// The SGB receives its command packets this way.
+	OnWrite func(val uint8)
+
+	// Player (0-3) is read from P10-P13 while neither P14 nor P15
+	// is selected. Only the SGB with multiplayer enabled changes it.
+	Player uint8
+
+	irq *interrupt.Interrupt
+}
+
+func New(mem *memory.Memory, irq *interrupt.Interrupt) *Joypad {
+	j := &Joypad{
+		sel: 0x30,
+		irq: irq,
+	}
+	mem.HandleRead(P1, j.read)
+	mem.HandleWrite(P1, j.write)
+	return j
+}
+
+func (j *Joypad) Press(b Button) {
+	j.update(func() { j.pressed |= 1 << uint(b) })
+}
+
+func (j *Joypad) Release(b Button) {
+	j.update(func() { j.pressed &^= 1 << uint(b) })
+}
+
+// Pressed returns the buttons held down, bit n for Button(n).
+func (j *Joypad) Pressed() uint8 {
+	return j.pressed
+}
+
+// SetPressed holds down exactly the buttons in pressed.
+func (j *Joypad) SetPressed(pressed uint8) {
+	j.update(func() { j.pressed = pressed })
+}
+
+// IsPressed reports whether b is currently held down.
+func (j *Joypad) IsPressed(b Button) bool {
+	return j.pressed&(1<<uint(b)) != 0
+}
+
+func (j *Joypad) read() uint8 {
+	return 0xC0 | j.sel | j.lines()
+}
+
+func (j *Joypad) write(val uint8) {
+	j.update(func() { j.sel = val & 0x30 })
+	if j.OnWrite != nil {
+		j.OnWrite(val)
+	}
+}
+
+// lines returns P10-P13 for the currently selected button rows.
+func (j *Joypad) lines() uint8 {
+	if j.sel == 0x30 {
+		return 0x0F - j.Player&0x03
+	}
+
+	var low uint8
+	if j.sel&0x10 == 0 {
+		low |= j.pressed & 0x0F
+	}
+	if j.sel&0x20 == 0 {
+		low |= j.pressed >> 4
+	}
+	return ^low & 0x0F
+}
+
+// update applies change and requests the joypad interrupt
+// when any of P10-P13 goes from high to low.
+func (j *Joypad) update(change func()) {
+	before := j.lines()
+	change()
+	after := j.lines()
+	if before&^after != 0 {
+		j.irq.SetIF_JoypadFlag()
+	}
+}
@@ -0,0 +1,95 @@
+package joypad
+
+import (
+	"strings"
+	"testing"
+	"tgb/interrupt"
+	"tgb/memory"
+)
+
+func newJoypad() (*Joypad, *memory.Memory) {
+	mem := memory.New()
+	return New(mem, interrupt.New(mem)), mem
+}
+
+// joypadIF reports whether the joypad interrupt is requested and clears it.
+func joypadIF(mem *memory.Memory) bool {
+	requested := mem.Read(interrupt.IF)&0x10 != 0
+	mem.Write(interrupt.IF, mem.Read(interrupt.IF)&^0x10)
+	return requested
+}
+
+func TestRowSelect(t *testing.T) {
+	j, mem := newJoypad()
+	j.Press(Right)
+	j.Press(Start)
+
+	tests := []struct {
+		name string
+		sel  uint8
+		want uint8
+	}{
+		{"directions", 0x20, 0xEE},
+		{"actions", 0x10, 0xD7},
+		{"both", 0x00, 0xC6},
+		{"none", 0x30, 0xFF},
+	}
+	for _, tt := range tests {
+		mem.Write(P1, tt.sel)
+		if got := mem.Read(P1); got != tt.want {
+			t.Errorf("%s: got %02X, want %02X", tt.name, got, tt.want)
+		}
+	}
+}
+
+// The interrupt is requested when one of P10-P13 goes from high to low.
+func TestInterrupt(t *testing.T) {
+	j, mem := newJoypad()
+	mem.Write(P1, 0x20)
+	joypadIF(mem)
+
+	j.Press(A)
+	if joypadIF(mem) {
+		t.Error("A isn't selected, but pressing it requested the interrupt")
+	}
+	j.Press(Up)
+	if !joypadIF(mem) {
+		t.Error("pressing Up didn't request the interrupt")
+	}
+	j.Release(Up)
+	if joypadIF(mem) {
+		t.Error("releasing Up requested the interrupt")
+	}
+	// A is still held down and pulls P10 low once its row is selected.
+	mem.Write(P1, 0x10)
+	if !joypadIF(mem) {
+		t.Error("selecting the action buttons with A held down didn't request the interrupt")
+	}
+}
+
+func TestScript(t *testing.T) {
+	script, err := ParseScript(strings.NewReader(`
+# hold Down on frames 2 and 3
+2 down press
+4 Down release
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	j, mem := newJoypad()
+	mem.Write(P1, 0x20)
+	joypadIF(mem)
+	for frame := 1; frame <= 5; frame++ {
+		script.Update(frame, j)
+		if irq, want := joypadIF(mem), frame == 2; irq != want {
+			t.Errorf("frame %d: interrupt %t, want %t", frame, irq, want)
+		}
+		if down, want := mem.Read(P1)&0x08 == 0, frame == 2 || frame == 3; down != want {
+			t.Errorf("frame %d: Down %t, want %t", frame, down, want)
+		}
+	}
+	if !script.Done() {
+		t.Error("the script isn't done")
+	}
+}
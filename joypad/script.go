@@ -0,0 +1,97 @@
+package joypad
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ScriptEvent presses or releases Button at the start of Frame.
+type ScriptEvent struct {
+	Frame   int
+	Button  Button
+	Pressed bool
+}
+
+// Script replays a fixed list of button events, e.g. for headless tests.
+type Script struct {
+	events []ScriptEvent
+	next   int
+}
+
+func NewScript(events ...ScriptEvent) *Script {
+	s := &Script{
+		events: append([]ScriptEvent{}, events...),
+	}
+	sort.SliceStable(s.events, func(i, j int) bool {
+		return s.events[i].Frame < s.events[j].Frame
+	})
+	return s
+}
+
+// ParseScript reads one event per line:
+//
+//	<frame> <button> press|release
+//
+// Empty lines and lines starting with '#' are ignored.
+func ParseScript(r io.Reader) (*Script, error) {
+	var events []ScriptEvent
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("line %d: want \"<frame> <button> press|release\"", n)
+		}
+		frame, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bad frame %q", n, fields[0])
+		}
+		b, ok := ParseButton(fields[1])
+		if !ok {
+			return nil, fmt.Errorf("line %d: unknown button %q", n, fields[1])
+		}
+		var pressed bool
+		switch fields[2] {
+		case "press":
+			pressed = true
+		case "release":
+			pressed = false
+		default:
+			return nil, fmt.Errorf("line %d: want press or release, got %q", n, fields[2])
+		}
+		events = append(events, ScriptEvent{Frame: frame, Button: b, Pressed: pressed})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return NewScript(events...), nil
+}
+
+func ParseButton(name string) (Button, bool) {
+	for b, s := range buttonNames {
+		if strings.EqualFold(s, name) {
+			return b, true
+		}
+	}
+	return 0, false
+}
+
+// Update sends every event scheduled up to frame to in.
+func (s *Script) Update(frame int, in Input) {
+	for ; s.next < len(s.events) && s.events[s.next].Frame <= frame; s.next++ {
+		setButton(in, s.events[s.next].Button, s.events[s.next].Pressed)
+	}
+}
+
+// Done reports whether every event has been sent.
+func (s *Script) Done() bool {
+	return s.next >= len(s.events)
+}
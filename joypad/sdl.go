@@ -0,0 +1,64 @@
+package joypad
+
+import (
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+var KeyMap = map[sdl.Keycode]Button{
+	sdl.K_RIGHT:     Right,
+	sdl.K_LEFT:      Left,
+	sdl.K_UP:        Up,
+	sdl.K_DOWN:      Down,
+	sdl.K_z:         A,
+	sdl.K_x:         B,
+	sdl.K_BACKSPACE: Select,
+	sdl.K_RETURN:    Start,
+}
+
+var ControllerMap = map[sdl.GameControllerButton]Button{
+	sdl.CONTROLLER_BUTTON_DPAD_RIGHT: Right,
+	sdl.CONTROLLER_BUTTON_DPAD_LEFT:  Left,
+	sdl.CONTROLLER_BUTTON_DPAD_UP:    Up,
+	sdl.CONTROLLER_BUTTON_DPAD_DOWN:  Down,
+	sdl.CONTROLLER_BUTTON_A:          A,
+	sdl.CONTROLLER_BUTTON_B:          B,
+	sdl.CONTROLLER_BUTTON_BACK:       Select,
+	sdl.CONTROLLER_BUTTON_START:      Start,
+}
+
+// HandleEvent forwards SDL keyboard and game controller events to in.
+// It reports whether the event was consumed.
+func HandleEvent(in Input, event sdl.Event) bool {
+	switch e := event.(type) {
+	case *sdl.KeyboardEvent:
+		b, ok := KeyMap[e.Keysym.Sym]
+		if !ok || e.Repeat != 0 {
+			return ok
+		}
+		setButton(in, b, e.State == sdl.PRESSED)
+		return true
+
+	case *sdl.ControllerButtonEvent:
+		b, ok := ControllerMap[sdl.GameControllerButton(e.Button)]
+		if !ok {
+			return false
+		}
+		setButton(in, b, e.State == sdl.PRESSED)
+		return true
+
+	case *sdl.ControllerDeviceEvent:
+		if e.Type == sdl.CONTROLLERDEVICEADDED {
+			sdl.GameControllerOpen(int(e.Which))
+		}
+		return true
+	}
+	return false
+}
+
+func setButton(in Input, b Button, pressed bool) {
+	if pressed {
+		in.Press(b)
+	} else {
+		in.Release(b)
+	}
+}
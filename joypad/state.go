@@ -0,0 +1,17 @@
+package joypad
+
+// State is what a save state keeps of the joypad. The buttons held
+// down aren't part of it, they are whatever the player holds now.
+type State struct {
+	Sel    uint8
+	Player uint8
+}
+
+func (j *Joypad) State() State {
+	return State{Sel: j.sel, Player: j.Player}
+}
+
+func (j *Joypad) SetState(s State) {
+	j.sel = s.Sel
+	j.Player = s.Player
+}
@@ -1,19 +1,62 @@
 package main
 
 import (
+	"fmt"
 	"log"
-	"tgb/gb"
+	"os"
 )
 
+const usage = `usage: tgb [command] [flags] <rom>
+
+commands:
+  run        run a ROM (default)
+  info       print the cartridge header
+  disasm     disassemble a ROM
+  debug      run a ROM in the debugger
+  tracediff  compare the execution of a ROM with a reference log
+  singlestep run the SM83 single step tests (default dir testdata/sm83/v1)
+  conformance
+             run a directory of test ROMs and report which pass
+  golden     compare the screen after some frames with a PNG
+
+Run "tgb <command> -h" for the flags of a command.
+`
+
 func main() {
-	filename := "roms/Tetris.gb"
-	gb := gb.New(filename)
-	err := gb.Boot()
+	log.SetFlags(0)
 
-	if err != nil {
-		log.Println(err)
-		return
+	args := os.Args[1:]
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
 	}
 
-	gb.Run()
+	var err error
+	switch args[0] {
+	case "run":
+		err = runCommand(args[1:])
+	case "info":
+		err = infoCommand(args[1:])
+	case "disasm":
+		err = disasmCommand(args[1:])
+	case "debug":
+		err = debugCommand(args[1:])
+	case "tracediff":
+		err = traceDiffCommand(args[1:])
+	case "singlestep":
+		err = singleStepCommand(args[1:])
+	case "conformance":
+		err = conformanceCommand(args[1:])
+	case "golden":
+		err = goldenCommand(args[1:])
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+	default:
+		// tgb roms/Tetris.gb
+		err = runCommand(args)
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
 }
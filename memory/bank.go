@@ -0,0 +1,85 @@
+package memory
+
+const (
+	// FF4F - VBK - CGB Mode Only - VRAM Bank
+	//  Bit 0 - VRAM Bank (0-1)
+	VBK = 0xFF4F
+
+	// FF70 - SVBK - CGB Mode Only - WRAM Bank
+	//  Bit 0-2 - Select WRAM Bank (1-7), writing 0 selects Bank 1
+	SVBK = 0xFF70
+
+	VRAM_START  = 0x8000
+	VRAM_SIZE   = 0x2000
+	WRAMX_START = 0xD000
+	WRAM_SIZE   = 0x1000
+)
+
+// banks holds the banks that aren't selected. Data always holds the
+// selected banks, so the rest of the emulator keeps reading and writing Data.
+type banks struct {
+	// CGB is true in CGB mode, where VRAM has 2 banks and
+	// D000-DFFF has WRAM banks 1-7.
+	CGB bool
+
+	vramBanks [2][VRAM_SIZE]uint8
+	wramBanks [8][WRAM_SIZE]uint8
+
+	vbk      uint8
+	svbk     uint8
+	wramBank uint8
+}
+
+// EnableCGB maps VBK and SVBK, which are unused on the DMG.
+func (m *Memory) EnableCGB() {
+	m.CGB = true
+	m.HandleRead(VBK, func() uint8 { return 0xFE | m.vbk })
+	m.HandleWrite(VBK, func(val uint8) { m.selectVRAMBank(val & 0x01) })
+	m.HandleRead(SVBK, func() uint8 { return 0xF8 | m.svbk })
+	m.HandleWrite(SVBK, func(val uint8) {
+		m.svbk = val & 0x07
+		bank := m.svbk
+		if bank == 0 {
+			bank = 1
+		}
+		m.selectWRAMBank(bank)
+	})
+}
+
+func (m *Memory) selectVRAMBank(bank uint8) {
+	if bank == m.vbk {
+		return
+	}
+	vram := m.Data[VRAM_START : VRAM_START+VRAM_SIZE]
+	copy(m.vramBanks[m.vbk][:], vram)
+	copy(vram, m.vramBanks[bank][:])
+	m.vbk = bank
+}
+
+func (m *Memory) selectWRAMBank(bank uint8) {
+	if bank == m.wramBank {
+		return
+	}
+	wram := m.Data[WRAMX_START : WRAMX_START+WRAM_SIZE]
+	copy(m.wramBanks[m.wramBank][:], wram)
+	copy(wram, m.wramBanks[bank][:])
+	m.wramBank = bank
+}
+
+// ReadVRAM reads addr (8000-9FFF) of a VRAM bank whether it is selected or not.
+// The GPU uses it for the BG Map Attributes in bank 1.
+func (m *Memory) ReadVRAM(bank uint8, addr uint16) uint8 {
+	if bank == m.vbk {
+		return m.Data[addr]
+	}
+	return m.vramBanks[bank][addr-VRAM_START]
+}
+
+// WriteVRAM writes addr (8000-9FFF) of a VRAM bank whether it is selected or not.
+func (m *Memory) WriteVRAM(bank uint8, addr uint16, val uint8) {
+	if bank == m.vbk {
+		m.Data[addr] = val
+		return
+	}
+	m.vramBanks[bank][addr-VRAM_START] = val
+}
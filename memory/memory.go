@@ -1,21 +1,76 @@
 package memory
 
-var Data [0x10000]uint8
+const BOOT = 0xFF50
 
-func Write(addr uint16, val uint8) {
+// Memory is the address space of one Game Boy.
+type Memory struct {
+	Data [0x10000]uint8
+
+	// BootROM is mapped over 0000-00FF until the boot ROM
+	// writes a non-zero value to FF50 at its very end.
+	BootROM []uint8
+
+	// I/O registers whose value depends on the state of another component
+	// (e.g. the joypad) are served by that component instead of Data.
+	readHandlers  map[uint16]func() uint8
+	writeHandlers map[uint16]func(uint8)
+
+	banks
+}
+
+func New() *Memory {
+	return &Memory{
+		readHandlers:  map[uint16]func() uint8{},
+		writeHandlers: map[uint16]func(uint8){},
+		banks:         banks{wramBank: 1},
+	}
+}
+
+// HandleRead makes every read of addr return the result of fn.
+func (m *Memory) HandleRead(addr uint16, fn func() uint8) {
+	m.readHandlers[addr] = fn
+}
+
+// HandleWrite makes every write to addr call fn instead of storing the value.
+func (m *Memory) HandleWrite(addr uint16, fn func(uint8)) {
+	m.writeHandlers[addr] = fn
+}
+
+func (m *Memory) Write(addr uint16, val uint8) {
 	// Unused memory area in GB
 	if 0xFEA0 <= addr && addr <= 0xFEFF {
 		return
 	}
 
-	Data[addr] = val
+	if addr == BOOT && val != 0 {
+		m.BootROM = nil
+	}
+
+	if 0xFF00 <= addr {
+		if fn, ok := m.writeHandlers[addr]; ok {
+			fn(val)
+			return
+		}
+	}
+
+	m.Data[addr] = val
 }
 
-func Read(addr uint16) uint8 {
+func (m *Memory) Read(addr uint16) uint8 {
+	if addr < 0x0100 && m.BootROM != nil {
+		return m.BootROM[addr]
+	}
+
 	// Unused memory area in GB
 	if 0xFEA0 <= addr && addr <= 0xFEFF {
 		return 0x00
 	}
 
-	return Data[addr]
+	if 0xFF00 <= addr {
+		if fn, ok := m.readHandlers[addr]; ok {
+			return fn()
+		}
+	}
+
+	return m.Data[addr]
 }
@@ -0,0 +1,47 @@
+package memory
+
+// State is the whole memory with the banks that aren't selected.
+// The handlers belong to the components, they keep their own state.
+type State struct {
+	Data [0x10000]uint8
+	// BootROM is mapped if BootROMMapped
+	BootROM       [0x100]uint8
+	BootROMMapped bool
+
+	CGB       bool
+	VRAMBanks [2][VRAM_SIZE]uint8
+	WRAMBanks [8][WRAM_SIZE]uint8
+	VBK       uint8
+	SVBK      uint8
+	WRAMBank  uint8
+}
+
+func (m *Memory) State() *State {
+	s := &State{
+		Data:          m.Data,
+		BootROMMapped: m.BootROM != nil,
+		CGB:           m.CGB,
+		VRAMBanks:     m.vramBanks,
+		WRAMBanks:     m.wramBanks,
+		VBK:           m.vbk,
+		SVBK:          m.svbk,
+		WRAMBank:      m.wramBank,
+	}
+	copy(s.BootROM[:], m.BootROM)
+	return s
+}
+
+// SetState restores s without calling the handlers.
+func (m *Memory) SetState(s *State) {
+	m.Data = s.Data
+	m.BootROM = nil
+	if s.BootROMMapped {
+		m.BootROM = append([]uint8(nil), s.BootROM[:]...)
+	}
+	m.CGB = s.CGB
+	m.vramBanks = s.VRAMBanks
+	m.wramBanks = s.WRAMBanks
+	m.vbk = s.VBK
+	m.svbk = s.SVBK
+	m.wramBank = s.WRAMBank
+}
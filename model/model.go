@@ -0,0 +1,49 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Model is the hardware the cartridge runs on. The boot ROM of each
+// model leaves the registers in a different state, which some games
+// use to tell which Game Boy they are on.
+type Model int
+
+const (
+	// Auto chooses the model from the cartridge header.
+	Auto Model = iota
+	DMG0       // early Game Boy, only sold in Japan
+	DMG        // Game Boy
+	MGB        // Game Boy Pocket
+	SGB        // Super Game Boy
+	CGB        // Game Boy Color
+	AGB        // Game Boy Advance
+)
+
+var names = [...]string{
+	Auto: "auto",
+	DMG0: "dmg0",
+	DMG:  "dmg",
+	MGB:  "mgb",
+	SGB:  "sgb",
+	CGB:  "cgb",
+	AGB:  "agb",
+}
+
+func (m Model) String() string {
+	if m < 0 || int(m) >= len(names) {
+		return fmt.Sprintf("Model(%d)", int(m))
+	}
+	return names[m]
+}
+
+// Parse returns the model named s, e.g. "dmg" or "cgb".
+func Parse(s string) (Model, error) {
+	for m, name := range names {
+		if strings.EqualFold(s, name) {
+			return Model(m), nil
+		}
+	}
+	return Auto, fmt.Errorf("Unknown model %q.", s)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"os"
+	"tgb/apu"
+	"tgb/gb"
+	"tgb/model"
+	"tgb/serial"
+)
+
+func runCommand(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	scale := fs.Int("scale", 5, "size of a Game Boy pixel on the window")
+	palette := fs.String("palette", "gray", "DMG palette: gray, green or pocket")
+	headless := fs.Bool("headless", false, "run without a window and sound")
+	frames := fs.Int("frames", 0, "stop after this many frames (0: until the window is closed)")
+	bootROM := fs.String("bootrom", "", "boot ROM to run before the cartridge")
+	saveDir := fs.String("savedir", ".", "directory for save data and the save states (Shift+F1-F9 save, F1-F9 load)")
+	tracePath := fs.String("trace", "", "write the CPU state before every instruction to this file, \"-\" for stdout")
+	symPath := fs.String("sym", "", "symbol file for the trace, <rom>.sym is loaded if it exists")
+	modelName := fs.String("model", "auto", "hardware model: auto, dmg0, dmg, mgb, sgb, cgb or agb")
+	colorCorrection := fs.Bool("color-correction", false, "show the CGB colors as the real LCD does")
+	wavPath := fs.String("wav", "", "record the sound to this WAV file")
+	printSerial := fs.Bool("serial", false, "print the bytes sent over the serial port")
+	listen := fs.String("link-listen", "", "wait for a link cable connection on this address")
+	connect := fs.String("link-connect", "", "connect the link cable to this address")
+	rewindInterval := fs.Int("rewind-interval", 4, "frames between the snapshots for rewinding (hold R), 0 turns it off")
+	rewindBudget := fs.Int("rewind-budget", 64, "megabytes kept for rewinding")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("run: expected exactly one ROM")
+	}
+
+	m, err := model.Parse(*modelName)
+	if err != nil {
+		return err
+	}
+
+	cfg := gb.Config{
+		Scale:           *scale,
+		Palette:         *palette,
+		Headless:        *headless,
+		Frames:          *frames,
+		BootROM:         *bootROM,
+		SaveDir:         *saveDir,
+		Model:           m,
+		ColorCorrection: *colorCorrection,
+	}
+	// Nobody can hold the rewind key without a window.
+	if !*headless {
+		cfg.RewindInterval = *rewindInterval
+		cfg.RewindBudget = *rewindBudget << 20
+	}
+	if *tracePath != "" {
+		cfg.Symbols, _, err = loadSymbols(*symPath, fs.Arg(0))
+		if err != nil {
+			return err
+		}
+	}
+	switch *tracePath {
+	case "":
+	case "-":
+		w := bufio.NewWriter(os.Stdout)
+		defer w.Flush()
+		cfg.Trace = w
+	default:
+		f, err := os.Create(*tracePath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w := bufio.NewWriter(f)
+		defer w.Flush()
+		cfg.Trace = w
+	}
+
+	gb, err := gb.New(fs.Arg(0), cfg)
+	if err != nil {
+		return err
+	}
+	if err := gb.Boot(); err != nil {
+		return err
+	}
+
+	switch {
+	case *wavPath != "":
+		sink, err := apu.CreateWAV(*wavPath, apu.DEFAULT_SAMPLE_RATE)
+		if err != nil {
+			return err
+		}
+		gb.Audio = sink
+	case !*headless:
+		sink, err := apu.NewSDLSink(apu.DEFAULT_SAMPLE_RATE)
+		if err != nil {
+			return err
+		}
+		gb.Audio = sink
+	}
+
+	if *printSerial {
+		gb.SerialOutput = os.Stdout
+	}
+
+	switch {
+	case *listen != "":
+		peer, err := serial.Listen(*listen)
+		if err != nil {
+			return err
+		}
+		gb.Serial.Peer = peer
+	case *connect != "":
+		peer, err := serial.Dial(*connect)
+		if err != nil {
+			return err
+		}
+		gb.Serial.Peer = peer
+	}
+
+	gb.Run()
+	return nil
+}
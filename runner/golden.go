@@ -0,0 +1,162 @@
+package runner
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"tgb/gb"
+	"tgb/gpu"
+	"tgb/joypad"
+	"tgb/model"
+)
+
+// Golden is a rendering test: the screen after Frames frames of ROM,
+// with Script pressing the buttons, has to look like the PNG Image.
+type Golden struct {
+	ROM    string
+	Image  string
+	Frames int
+	// Script, if set, is replayed on the joypad.
+	Script *joypad.Script
+	Model  model.Model
+}
+
+// GoldenResult is the result of Golden.Run.
+type GoldenResult struct {
+	// The screen after the last frame
+	Screen *image.RGBA
+	Hash   string
+	// Number of pixels that differ from the golden image
+	Diffs int
+	// The screen with the differing pixels in red, nil if none differ
+	DiffImage *image.RGBA
+}
+
+// Run runs the ROM for g.Frames frames and compares the screen with g.Image.
+func (g Golden) Run() (*GoldenResult, error) {
+	screen, err := g.Render()
+	if err != nil {
+		return nil, err
+	}
+	want, err := LoadPNG(g.Image)
+	if err != nil {
+		return nil, err
+	}
+	if want.Bounds().Size() != screen.Bounds().Size() {
+		return nil, fmt.Errorf("%s is %v, the screen is %v", g.Image, want.Bounds().Size(), screen.Bounds().Size())
+	}
+	r := &GoldenResult{Screen: screen, Hash: ImageHash(screen)}
+	r.DiffImage, r.Diffs = DiffImages(want, screen)
+	return r, nil
+}
+
+// Render runs the ROM for g.Frames frames and returns the screen.
+func (g Golden) Render() (*image.RGBA, error) {
+	if g.Frames <= 0 {
+		return nil, fmt.Errorf("%s: no frames to run", g.ROM)
+	}
+	emu, err := gb.New(g.ROM, gb.Config{
+		Headless: true,
+		Frames:   g.Frames,
+		Model:    g.Model,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := emu.Boot(); err != nil {
+		return nil, err
+	}
+	emu.Script = g.Script
+	for !emu.Done() {
+		emu.Step()
+	}
+	return Screenshot(emu.GPU), nil
+}
+
+// Screenshot copies GPU.Screen into an image.
+func Screenshot(g *gpu.GPU) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, gpu.SCREEN_WIDTH, gpu.SCREEN_HEIGHT))
+	for y := 0; y < gpu.SCREEN_HEIGHT; y++ {
+		for x := 0; x < gpu.SCREEN_WIDTH; x++ {
+			c := g.Pixel(x, y)
+			img.SetRGBA(x, y, color.RGBA{uint8(c >> 16), uint8(c >> 8), uint8(c), 0xFF})
+		}
+	}
+	return img
+}
+
+// ImageHash returns the SHA-1 of the colors of img, the same as
+// ScreenHash if img is a screenshot.
+func ImageHash(img image.Image) string {
+	h := sha1.New()
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, _ := img.At(x, y).RGBA()
+			h.Write([]uint8{uint8(r >> 8), uint8(g >> 8), uint8(bl >> 8)})
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// DiffImages compares got with want pixel by pixel. The diff image is got
+// faded to gray with the differing pixels in red; it is nil if they are
+// the same. The pixels of got outside of want differ.
+func DiffImages(want, got image.Image) (*image.RGBA, int) {
+	wb, b := want.Bounds(), got.Bounds()
+	diff := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	n := 0
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			c := got.At(b.Min.X+x, b.Min.Y+y)
+			if x < wb.Dx() && y < wb.Dy() && sameColor(want.At(wb.Min.X+x, wb.Min.Y+y), c) {
+				gray := color.GrayModel.Convert(c).(color.Gray).Y
+				// faded, so that the red stands out
+				gray = 0xC0 + gray/4
+				diff.SetRGBA(x, y, color.RGBA{gray, gray, gray, 0xFF})
+				continue
+			}
+			n++
+			diff.SetRGBA(x, y, color.RGBA{0xFF, 0x00, 0x00, 0xFF})
+		}
+	}
+	if n == 0 {
+		return nil, 0
+	}
+	return diff, n
+}
+
+func sameColor(a, b color.Color) bool {
+	r1, g1, b1, _ := a.RGBA()
+	r2, g2, b2, _ := b.RGBA()
+	return r1>>8 == r2>>8 && g1>>8 == g2>>8 && b1>>8 == b2>>8
+}
+
+func LoadPNG(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return img, nil
+}
+
+func SavePNG(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
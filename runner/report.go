@@ -0,0 +1,82 @@
+package runner
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// WriteMarkdown writes the results as a Markdown table.
+func WriteMarkdown(w io.Writer, results []Result) error {
+	fmt.Fprintln(w, "| ROM | Result | Method | Frames | Detail |")
+	fmt.Fprintln(w, "| --- | --- | --- | ---: | --- |")
+	for _, r := range results {
+		detail := strings.Replace(r.Detail, "|", "\\|", -1)
+		fmt.Fprintf(w, "| %s | %s | %s | %d | %s |\n", r.ROM, r.Status, r.Method, r.Frames, detail)
+	}
+	_, err := fmt.Fprintf(w, "\n%s\n", Summary(results))
+	return err
+}
+
+func WriteJSON(w io.Writer, results []Result) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(results)
+}
+
+// LoadHashes reads a file in the format of sha1sum, "<hash>  <rom>"
+// per line, with the ROMs relative to the directory of the test ROMs.
+func LoadHashes(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hashes := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected \"<hash>  <rom>\"", path, n)
+		}
+		hashes[strings.TrimSpace(fields[1])] = fields[0]
+	}
+	return hashes, scanner.Err()
+}
+
+// WriteHashes writes hashes and the last screens of the ROMs that timed
+// out, in the format of LoadHashes. The ROMs that only show their result
+// on the screen time out until their hash is known: look at the screens
+// before keeping the new hashes.
+func WriteHashes(w io.Writer, hashes map[string]string, results []Result) error {
+	all := map[string]string{}
+	for rom, hash := range hashes {
+		all[rom] = hash
+	}
+	for _, r := range results {
+		if r.Status == Timeout && r.ScreenHash != "" {
+			all[r.ROM] = r.ScreenHash
+		}
+	}
+
+	roms := make([]string, 0, len(all))
+	for rom := range all {
+		roms = append(roms, rom)
+	}
+	sort.Strings(roms)
+	for _, rom := range roms {
+		if _, err := fmt.Fprintf(w, "%s  %s\n", all[rom], rom); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+// Package runner runs test ROMs headlessly and tells whether they pass.
+// A ROM passes or fails
+//
+//   - by its serial output, "Passed" or "Failed" as the tests of Blargg print,
+//   - by the registers at "LD B,B", which the Mooneye tests execute at the end:
+//     B=3, C=5, D=8, E=13, H=21, L=34 on success and 0x42 everywhere on failure,
+//   - or by the hash of the screen, for the ROMs that only show their result.
+package runner
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"tgb/cpu"
+	"tgb/gb"
+	"tgb/gpu"
+	"tgb/model"
+)
+
+type Status string
+
+const (
+	Pass    Status = "pass"
+	Fail    Status = "fail"
+	Timeout Status = "timeout"
+	Error   Status = "error"
+)
+
+// How the result was found
+type Method string
+
+const (
+	Serial    Method = "serial"
+	Registers Method = "registers"
+	Screen    Method = "screen"
+)
+
+// Result is the result of one ROM.
+type Result struct {
+	ROM    string `json:"rom"`
+	Status Status `json:"status"`
+	Method Method `json:"method,omitempty"`
+	Frames int    `json:"frames"`
+	Detail string `json:"detail,omitempty"`
+	// Hash of the last screen, to add to the hashes of the passing ROMs
+	ScreenHash string `json:"screen_hash,omitempty"`
+}
+
+type Options struct {
+	// A ROM times out after this many frames.
+	Frames int
+	Model  model.Model
+	// Screen hashes of the passing ROMs, by the ROM path relative to the directory
+	Hashes map[string]string
+	// DMG boot ROM to run before each ROM instead of the built-in boot,
+	// which only starts the ROMs with the licensed logo
+	BootROM string
+}
+
+const (
+	DEFAULT_FRAMES = 60 * 60
+	// frames to wait for the rest of the serial output after "Failed"
+	FRAMES_AFTER_FAILED = 30
+)
+
+// Mooneye's signature of success
+var fibonacci = cpu.Registers{B: 3, C: 5, D: 8, E: 13, H: 21, L: 34}
+
+// RunDir runs every .gb and .gbc file in dir and its subdirectories.
+func RunDir(dir string, opt Options) ([]Result, error) {
+	var roms []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if !info.IsDir() && (ext == ".gb" || ext == ".gbc") {
+			roms = append(roms, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(roms)
+
+	results := make([]Result, 0, len(roms))
+	for _, path := range roms {
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			name = path
+		}
+		r := Run(path, opt.Hashes[filepath.ToSlash(name)], opt)
+		r.ROM = filepath.ToSlash(name)
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// Run runs the ROM at path until it passes or fails, or until opt.Frames.
+// hash is the screen hash of success, empty if unknown.
+func Run(path, hash string, opt Options) (result Result) {
+	result = Result{ROM: path}
+	defer func() {
+		if r := recover(); r != nil {
+			result.Status = Error
+			result.Detail = fmt.Sprint(r)
+		}
+	}()
+
+	frames := opt.Frames
+	if frames <= 0 {
+		frames = DEFAULT_FRAMES
+	}
+	g, err := gb.New(path, gb.Config{
+		Headless: true,
+		Frames:   frames,
+		Model:    opt.Model,
+		BootROM:  opt.BootROM,
+	})
+	if err == nil {
+		err = g.Boot()
+	}
+	if err != nil {
+		result.Status = Error
+		result.Detail = err.Error()
+		return result
+	}
+
+	serialLen, frame := 0, -1
+	// The details come after "Failed".
+	failedAt := -1
+	for !g.Done() {
+		if failedAt >= 0 && g.Frame()-failedAt >= FRAMES_AFTER_FAILED {
+			break
+		}
+
+		// LD B,B
+		if g.Memory.Read(g.CPU.PC()) == 0x40 {
+			r := g.CPU.Get()
+			sig := cpu.Registers{B: r.B, C: r.C, D: r.D, E: r.E, H: r.H, L: r.L}
+			switch sig {
+			case fibonacci:
+				return finish(result, g, Pass, Registers, "")
+			case cpu.Registers{B: 0x42, C: 0x42, D: 0x42, E: 0x42, H: 0x42, L: 0x42}:
+				return finish(result, g, Fail, Registers, r.String())
+			}
+		}
+
+		g.Step()
+
+		if n := g.SerialLog.Len(); n != serialLen && failedAt < 0 {
+			serialLen = n
+			out := g.SerialLog.Bytes()
+			switch {
+			case bytes.Contains(out, []byte("Passed")):
+				return finish(result, g, Pass, Serial, "")
+			case bytes.Contains(out, []byte("Failed")):
+				failedAt = g.Frame()
+			}
+		}
+
+		if hash != "" && failedAt < 0 && g.Frame() != frame {
+			frame = g.Frame()
+			if ScreenHash(g.GPU) == hash {
+				return finish(result, g, Pass, Screen, "")
+			}
+		}
+	}
+
+	if failedAt >= 0 {
+		return finish(result, g, Fail, Serial, lastLines(g.SerialLog.Bytes(), 3))
+	}
+	if hash != "" {
+		return finish(result, g, Fail, Screen, "the screen never matched")
+	}
+	detail := ""
+	if g.SerialLog.Len() > 0 {
+		detail = lastLines(g.SerialLog.Bytes(), 3)
+	}
+	return finish(result, g, Timeout, "", detail)
+}
+
+func finish(r Result, g *gb.GB, status Status, method Method, detail string) Result {
+	r.Status = status
+	r.Method = method
+	r.Detail = detail
+	r.Frames = g.Frame()
+	r.ScreenHash = ScreenHash(g.GPU)
+	return r
+}
+
+// ScreenHash returns the SHA-1 of the colors on the screen.
+func ScreenHash(g *gpu.GPU) string {
+	return ImageHash(Screenshot(g))
+}
+
+// lastLines returns the last n lines of the serial output in one line.
+func lastLines(out []byte, n int) string {
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, " / ")
+}
+
+// Summary counts the results by status, e.g. "12/20 pass, 5 fail, 3 timeout".
+func Summary(results []Result) string {
+	count := map[Status]int{}
+	for _, r := range results {
+		count[r.Status]++
+	}
+	s := fmt.Sprintf("%d/%d pass", count[Pass], len(results))
+	for _, status := range []Status{Fail, Timeout, Error} {
+		if count[status] > 0 {
+			s += fmt.Sprintf(", %d %s", count[status], status)
+		}
+	}
+	return s
+}
@@ -0,0 +1,158 @@
+package runner
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"tgb/asm"
+)
+
+// The test ROMs to track, e.g. Blargg's and Mooneye's,
+// with hashes.txt for the ones that only show their result.
+const romDir = "../testdata/roms"
+
+func TestRunDir(t *testing.T) {
+	if _, err := os.Stat(romDir); err != nil {
+		t.Skipf("no test ROMs in %s", romDir)
+	}
+	opt := Options{}
+	if hashes := filepath.Join(romDir, "hashes.txt"); fileExists(hashes) {
+		var err error
+		if opt.Hashes, err = LoadHashes(hashes); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := RunDir(romDir, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		if r.Status != Pass {
+			t.Errorf("%s: %s %s after %d frames %s", r.ROM, r.Status, r.Method, r.Frames, r.Detail)
+		}
+	}
+	t.Log(Summary(results))
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// The ROMs built here don't have the licensed logo, which the built-in
+// boot checks. This boot ROM only unmaps itself at the end, as the real
+// one does, and the ROM starts at 0100.
+const bootROM = `
+	ORG $0000
+	LD SP,$FFFE
+	LD A,1
+	JP $00FE
+	ORG $00FE
+	LDH [$50],A`
+
+// makeROM writes a 32KB ROM with code at 0150 and returns the options
+// to run it.
+func makeROM(t *testing.T, code string) (string, Options) {
+	t.Helper()
+	dir := t.TempDir()
+
+	boot := filepath.Join(dir, "boot.bin")
+	if err := ioutil.WriteFile(boot, asm.MustAssemble(bootROM), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rom := make([]uint8, 0x8000)
+	copy(rom[0x0100:], asm.MustAssemble("ORG $0100\nNOP\nJP $0150"))
+	copy(rom[0x0134:], "TEST")
+	copy(rom[0x0150:], asm.MustAssemble("ORG $0150\n"+code))
+	path := filepath.Join(dir, "test.gb")
+	if err := ioutil.WriteFile(path, rom, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path, Options{Frames: 30, BootROM: boot}
+}
+
+// serial prints text on the serial port, as Blargg's tests do.
+func serial(text string) string {
+	var src strings.Builder
+	for _, c := range []byte(text) {
+		fmt.Fprintf(&src, "LD A,%d\n", c)
+		src.WriteString("LDH [$FF01],A\nLD A,$81\nLDH [$FF02],A\n")
+		src.WriteString("LDH A,[$FF02]\nBIT 7,A\nJR NZ,@-4\n")
+	}
+	return src.String()
+}
+
+const (
+	fibonacciCode = `
+	LD B,3
+	LD C,5
+	LD D,8
+	LD E,13
+	LD H,21
+	LD L,34
+	LD B,B
+	JR @`
+	failureCode = `
+	LD A,$42
+	LD B,A
+	LD C,A
+	LD D,A
+	LD E,A
+	LD H,A
+	LD L,A
+	LD B,B
+	JR @`
+	// draws nothing and waits
+	idleCode = "JR @"
+)
+
+func TestDetection(t *testing.T) {
+	tests := []struct {
+		name   string
+		code   string
+		status Status
+		method Method
+		detail string
+	}{
+		{"fibonacci", fibonacciCode, Pass, Registers, ""},
+		{"0x42", failureCode, Fail, Registers, "BC=4242 DE=4242 HL=4242"},
+		{"passed", serial("cpu_instrs\n\nPassed\n") + idleCode, Pass, Serial, ""},
+		{"failed", serial("cpu_instrs\n\n01 Failed #2\n") + idleCode, Fail, Serial, "01 Failed #2"},
+		{"timeout", idleCode, Timeout, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, opt := makeROM(t, tt.code)
+			r := Run(path, "", opt)
+			if r.Status != tt.status || r.Method != tt.method || !strings.Contains(r.Detail, tt.detail) {
+				t.Errorf("got %s %q %q, want %s %q %q", r.Status, r.Method, r.Detail, tt.status, tt.method, tt.detail)
+			}
+		})
+	}
+}
+
+func TestScreenHash(t *testing.T) {
+	path, opt := makeROM(t, idleCode)
+
+	// The first run finds the hash of the screen the ROM shows.
+	first := Run(path, "", opt)
+	if first.Status != Timeout || first.ScreenHash == "" {
+		t.Fatalf("got %s with hash %q, want a timeout with a hash", first.Status, first.ScreenHash)
+	}
+
+	r := Run(path, first.ScreenHash, opt)
+	if r.Status != Pass || r.Method != Screen {
+		t.Errorf("with the hash of its screen: got %s %q, want pass by screen", r.Status, r.Method)
+	}
+
+	r = Run(path, strings.Repeat("0", len(first.ScreenHash)), opt)
+	if r.Status != Fail || r.Method != Screen {
+		t.Errorf("with another hash: got %s %q, want fail by screen", r.Status, r.Method)
+	}
+}
@@ -0,0 +1,139 @@
+package serial
+
+import (
+	"errors"
+	"io"
+	"net"
+)
+
+type message struct {
+	data    uint8
+	clocked bool
+}
+
+// The wire format is two bytes per message: kind and data.
+const (
+	kindClock   = 'C'
+	kindRespond = 'R'
+)
+
+var ErrLinkFull = errors.New("link buffer is full")
+
+// Loopback is one end of an in-process link cable, e.g. for tests
+// that run two emulators side by side.
+type Loopback struct {
+	in  chan message
+	out chan message
+}
+
+// NewLoopback returns both ends of a link cable.
+func NewLoopback() (*Loopback, *Loopback) {
+	a := make(chan message, 64)
+	b := make(chan message, 64)
+	return &Loopback{in: a, out: b}, &Loopback{in: b, out: a}
+}
+
+func (l *Loopback) Clock(out uint8) error {
+	return l.send(message{data: out, clocked: true})
+}
+
+func (l *Loopback) Respond(out uint8) error {
+	return l.send(message{data: out})
+}
+
+func (l *Loopback) send(m message) error {
+	select {
+	case l.out <- m:
+		return nil
+	default:
+		return ErrLinkFull
+	}
+}
+
+func (l *Loopback) Poll() (uint8, bool, bool) {
+	return poll(l.in)
+}
+
+func (l *Loopback) Close() error {
+	return nil
+}
+
+// TCPPeer links two emulator processes over a TCP connection.
+type TCPPeer struct {
+	conn     net.Conn
+	incoming chan message
+}
+
+// Listen waits for the other emulator to Dial addr.
+func Listen(addr string) (*TCPPeer, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer l.Close()
+
+	conn, err := l.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return NewTCPPeer(conn), nil
+}
+
+func Dial(addr string) (*TCPPeer, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewTCPPeer(conn), nil
+}
+
+func NewTCPPeer(conn net.Conn) *TCPPeer {
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetNoDelay(true)
+	}
+	p := &TCPPeer{
+		conn:     conn,
+		incoming: make(chan message, 64),
+	}
+	go p.receive()
+	return p
+}
+
+func (p *TCPPeer) receive() {
+	defer close(p.incoming)
+
+	buf := make([]byte, 2)
+	for {
+		if _, err := io.ReadFull(p.conn, buf); err != nil {
+			return
+		}
+		p.incoming <- message{data: buf[1], clocked: buf[0] == kindClock}
+	}
+}
+
+func (p *TCPPeer) Clock(out uint8) error {
+	_, err := p.conn.Write([]byte{kindClock, out})
+	return err
+}
+
+func (p *TCPPeer) Respond(out uint8) error {
+	_, err := p.conn.Write([]byte{kindRespond, out})
+	return err
+}
+
+func (p *TCPPeer) Poll() (uint8, bool, bool) {
+	return poll(p.incoming)
+}
+
+func (p *TCPPeer) Close() error {
+	return p.conn.Close()
+}
+
+func poll(c chan message) (uint8, bool, bool) {
+	select {
+	case m, ok := <-c:
+		return m.data, m.clocked, ok
+	default:
+		return 0, false, false
+	}
+}
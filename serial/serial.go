@@ -0,0 +1,173 @@
+package serial
+
+import (
+	"log"
+	"tgb/interrupt"
+	"tgb/memory"
+	"tgb/timer"
+)
+
+const (
+	// FF01 - SB - Serial transfer data (R/W)
+	// Before a transfer, it holds the next byte that will go out.
+	// During a transfer, it has a blend of the outgoing and incoming bytes.
+	SB = 0xFF01
+
+	// FF02 - SC - Serial Transfer Control (R/W)
+	//  Bit 7 - Transfer Start Flag (0=No transfer is in progress or requested, 1=Transfer in progress, or requested)
+	//  Bit 1 - Clock Speed (0=Normal, 1=Fast) ** CGB Mode Only **
+	//  Bit 0 - Shift Clock (0=External Clock, 1=Internal Clock)
+	SC = 0xFF02
+
+	// With the internal clock a bit is shifted at 8192Hz (262144Hz in fast mode).
+	CYCLES_TRANSFER      = timer.CLOCK_CYCLE / 8192 * 8
+	CYCLES_TRANSFER_FAST = timer.CLOCK_CYCLE / 262144 * 8
+
+	// How long we wait for the other Game Boy to answer before
+	// assuming nothing is connected.
+	CYCLES_REPLY_TIMEOUT = timer.CYCLES_FRAME
+)
+
+// SerialPeer is the other end of the link cable.
+type SerialPeer interface {
+	// Clock sends out when this side starts a transfer with the internal clock.
+	Clock(out uint8) error
+	// Respond sends out as the answer to a transfer the other side clocked.
+	Respond(out uint8) error
+	// Poll returns the next byte from the other side without blocking.
+	// clocked is true when the other side started a transfer,
+	// false when it is the answer to our Clock.
+	Poll() (in uint8, clocked bool, ok bool)
+	Close() error
+}
+
+type Serial struct {
+	sb uint8
+	sc uint8
+
+	// Peer is nil when no cable is connected.
+	Peer SerialPeer
+
+	// OnTransfer, if set, is called with every byte this side sends
+	// with the internal clock. Test ROMs print their results this way.
+	OnTransfer func(out uint8)
+
+	// clocks since a transfer with the internal clock started
+	cycle int
+
+	reply    uint8
+	hasReply bool
+
+	irq *interrupt.Interrupt
+}
+
+func New(mem *memory.Memory, irq *interrupt.Interrupt) *Serial {
+	s := &Serial{irq: irq}
+	mem.HandleRead(SB, func() uint8 { return s.sb })
+	mem.HandleWrite(SB, func(val uint8) { s.sb = val })
+	mem.HandleRead(SC, func() uint8 { return s.sc | 0x7C })
+	mem.HandleWrite(SC, s.writeSC)
+	return s
+}
+
+func (s *Serial) Update(cycles int) {
+	if s.Peer != nil {
+		s.poll()
+	}
+
+	if !s.transferring() || !s.internalClock() {
+		return
+	}
+
+	s.cycle += cycles
+	duration := CYCLES_TRANSFER
+	if s.sc&0x02 != 0 {
+		duration = CYCLES_TRANSFER_FAST
+	}
+	if s.cycle < duration {
+		return
+	}
+
+	switch {
+	case s.Peer == nil:
+		// Nothing is connected, the line is pulled high.
+		s.complete(0xFF)
+	case s.hasReply:
+		s.complete(s.reply)
+	case s.cycle >= duration+CYCLES_REPLY_TIMEOUT:
+		s.complete(0xFF)
+	}
+}
+
+func (s *Serial) transferring() bool {
+	return s.sc&0x80 != 0
+}
+
+func (s *Serial) internalClock() bool {
+	return s.sc&0x01 != 0
+}
+
+func (s *Serial) writeSC(val uint8) {
+	s.sc = val & 0x83
+	if !s.transferring() || !s.internalClock() {
+		return
+	}
+
+	s.cycle = 0
+	s.hasReply = false
+	if s.OnTransfer != nil {
+		s.OnTransfer(s.sb)
+	}
+	if s.Peer != nil {
+		if err := s.Peer.Clock(s.sb); err != nil {
+			s.disconnect(err)
+		}
+	}
+}
+
+func (s *Serial) poll() {
+	for s.Peer != nil {
+		in, clocked, ok := s.Peer.Poll()
+		if !ok {
+			return
+		}
+
+		if !clocked {
+			if s.transferring() && s.internalClock() {
+				s.reply = in
+				s.hasReply = true
+			}
+			continue
+		}
+
+		// The other side drives the clock. We only take part
+		// when a transfer with the external clock was requested.
+		if s.transferring() && !s.internalClock() {
+			out := s.sb
+			s.complete(in)
+			s.respond(out)
+		} else {
+			s.respond(0xFF)
+		}
+	}
+}
+
+func (s *Serial) respond(out uint8) {
+	if err := s.Peer.Respond(out); err != nil {
+		s.disconnect(err)
+	}
+}
+
+func (s *Serial) disconnect(err error) {
+	log.Println("serial:", err)
+	s.Peer.Close()
+	s.Peer = nil
+}
+
+// complete finishes the transfer in progress and requests the serial interrupt.
+func (s *Serial) complete(in uint8) {
+	s.sb = in
+	s.sc &^= 0x80
+	s.hasReply = false
+	s.irq.SetIF_SerialFlag()
+}
@@ -0,0 +1,73 @@
+package serial
+
+import (
+	"testing"
+	"tgb/interrupt"
+	"tgb/memory"
+)
+
+// gameBoy is one end of the cable with its own memory.
+type gameBoy struct {
+	*Serial
+	mem *memory.Memory
+}
+
+func newGameBoy() gameBoy {
+	mem := memory.New()
+	return gameBoy{New(mem, interrupt.New(mem)), mem}
+}
+
+// serialIF reports whether the serial interrupt is requested and clears it.
+func (gb gameBoy) serialIF() bool {
+	requested := gb.mem.Read(interrupt.IF)&0x08 != 0
+	gb.mem.Write(interrupt.IF, gb.mem.Read(interrupt.IF)&^0x08)
+	return requested
+}
+
+func TestLoopback(t *testing.T) {
+	master, slave := newGameBoy(), newGameBoy()
+	master.Peer, slave.Peer = NewLoopback()
+
+	// The slave waits for the clock of the master.
+	slave.mem.Write(SB, 0x34)
+	slave.mem.Write(SC, 0x80)
+	master.mem.Write(SB, 0x12)
+	master.mem.Write(SC, 0x81)
+
+	slave.Update(4)
+	if sb, sc := slave.mem.Read(SB), slave.mem.Read(SC); sb != 0x12 || sc&0x80 != 0 {
+		t.Errorf("slave: SB=%02X SC=%02X, want SB=12 with bit 7 of SC cleared", sb, sc)
+	}
+	if !slave.serialIF() {
+		t.Error("slave: the serial interrupt isn't requested")
+	}
+	if master.serialIF() {
+		t.Error("master: the serial interrupt is requested before the transfer completes")
+	}
+
+	for cycles := 0; master.mem.Read(SC)&0x80 != 0; cycles += 4 {
+		if cycles > CYCLES_TRANSFER {
+			t.Fatalf("master: the transfer didn't complete in %d clocks", CYCLES_TRANSFER)
+		}
+		master.Update(4)
+	}
+	if sb := master.mem.Read(SB); sb != 0x34 {
+		t.Errorf("master: SB=%02X, want 34", sb)
+	}
+	if !master.serialIF() {
+		t.Error("master: the serial interrupt isn't requested")
+	}
+}
+
+// Without a cable the master shifts in 1s.
+func TestNoPeer(t *testing.T) {
+	gb := newGameBoy()
+	gb.mem.Write(SB, 0x12)
+	gb.mem.Write(SC, 0x81)
+	for cycles := 0; cycles < CYCLES_TRANSFER; cycles += 4 {
+		gb.Update(4)
+	}
+	if sb, sc := gb.mem.Read(SB), gb.mem.Read(SC); sb != 0xFF || sc&0x80 != 0 || !gb.serialIF() {
+		t.Errorf("SB=%02X SC=%02X, want SB=FF, bit 7 of SC cleared and the interrupt", sb, sc)
+	}
+}
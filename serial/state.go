@@ -0,0 +1,22 @@
+package serial
+
+// State is what a save state keeps of the serial port.
+// The link cable stays connected as it is.
+type State struct {
+	SB, SC   uint8
+	Cycle    int64
+	Reply    uint8
+	HasReply bool
+}
+
+func (s *Serial) State() State {
+	return State{SB: s.sb, SC: s.sc, Cycle: int64(s.cycle), Reply: s.reply, HasReply: s.hasReply}
+}
+
+func (s *Serial) SetState(st State) {
+	s.sb = st.SB
+	s.sc = st.SC
+	s.cycle = int(st.Cycle)
+	s.reply = st.Reply
+	s.hasReply = st.HasReply
+}
@@ -0,0 +1,129 @@
+package sgb
+
+import (
+	"tgb/gpu"
+)
+
+const (
+	// CHR_TRN and PCT_TRN copy 4KB shown on the screen as 256 tiles.
+	TRANSFER_SIZE = 0x1000
+
+	BORDER_TILES_X = gpu.SGB_WIDTH / 8
+	BORDER_TILES_Y = gpu.SGB_HEIGHT / 8
+)
+
+// Render draws the border and the colorized screen to frame.
+// It is called once a frame, after the screen has been drawn.
+func (s *SGB) Render(shades *[gpu.SCREEN_WIDTH][gpu.SCREEN_HEIGHT]uint8, frame *[gpu.SGB_WIDTH][gpu.SGB_HEIGHT]uint32) {
+	if s.transfer != 0 {
+		s.vramTransfer()
+	}
+
+	backdrop := toARGB(s.palettes[0][0])
+	for x := 0; x < gpu.SGB_WIDTH; x++ {
+		for y := 0; y < gpu.SGB_HEIGHT; y++ {
+			sx, sy := x-gpu.SGB_SCREEN_X, y-gpu.SGB_SCREEN_Y
+			inScreen := 0 <= sx && sx < gpu.SCREEN_WIDTH && 0 <= sy && sy < gpu.SCREEN_HEIGHT
+
+			if color, ok := s.borderPixel(x, y); ok {
+				frame[x][y] = color
+				continue
+			}
+			if !inScreen {
+				frame[x][y] = backdrop
+				continue
+			}
+
+			switch s.mask {
+			case MASK_CANCEL:
+				palette := s.attrs[sx/8][sy/8]
+				frame[x][y] = toARGB(s.palettes[palette][shades[sx][sy]])
+			case MASK_FREEZE:
+				// keep the last picture
+			case MASK_BLACK:
+				frame[x][y] = toARGB(0x0000)
+			case MASK_COLOR0:
+				frame[x][y] = backdrop
+			}
+		}
+	}
+}
+
+// borderPixel returns the color of the border at (x, y),
+// ok is false where the border is transparent (color 0).
+func (s *SGB) borderPixel(x, y int) (uint32, bool) {
+	entry := s.borderMap[y/8*32+x/8]
+	tile := int(entry & 0xFF)
+	palette := int(entry>>10&0x07) - 4
+	px, py := x%8, y%8
+	if entry&0x4000 != 0 {
+		px = 7 - px
+	}
+	if entry&0x8000 != 0 {
+		py = 7 - py
+	}
+
+	// A SNES 4bpp tile is 32 bytes: 8 rows of bitplanes 0 and 1,
+	// then 8 rows of bitplanes 2 and 3.
+	t := s.borderTiles[tile*32:]
+	bit := uint(7 - px)
+	color := t[py*2]>>bit&0x01 |
+		(t[py*2+1]>>bit&0x01)<<1 |
+		(t[16+py*2]>>bit&0x01)<<2 |
+		(t[16+py*2+1]>>bit&0x01)<<3
+	if color == 0 || palette < 0 {
+		return 0, false
+	}
+	return toARGB(s.borderPalettes[palette][color]), true
+}
+
+// vramTransfer reads the 4KB on the screen, i.e. the tiles of the
+// BG map from its top left corner, 20 tiles per line.
+func (s *SGB) vramTransfer() {
+	var data [TRANSFER_SIZE]uint8
+	lcdc := s.mem.Read(gpu.LCDC)
+	mapBase := uint16(0x9800)
+	if lcdc&0x08 != 0 {
+		mapBase = 0x9C00
+	}
+	for i := 0; i < TRANSFER_SIZE/16; i++ {
+		tile := s.mem.Read(mapBase + uint16(i/20*32+i%20))
+		var addr uint16
+		if lcdc&0x10 != 0 {
+			addr = 0x8000 + uint16(tile)*16
+		} else {
+			addr = uint16(0x9000 + int(int8(tile))*16)
+		}
+		for j := uint16(0); j < 16; j++ {
+			data[i*16+int(j)] = s.mem.Read(addr + j)
+		}
+	}
+
+	switch s.transfer {
+	case CHR_TRN:
+		// Bit 0 - Tile Numbers (0=Tiles 00h-7Fh, 1=Tiles 80h-FFh)
+		offset := int(s.transferArg&0x01) * TRANSFER_SIZE
+		copy(s.borderTiles[offset:], data[:])
+	case PCT_TRN:
+		// 000-7FF BG Map 32x32 Entries of 16bit each
+		// 800-87F BG Palette Data (Palettes 4-7, each 16 colors of 16bits each)
+		for i := range s.borderMap {
+			s.borderMap[i] = uint16(data[i*2]) | uint16(data[i*2+1])<<8
+		}
+		for p := range s.borderPalettes {
+			for c := range s.borderPalettes[p] {
+				i := 0x800 + (p*16+c)*2
+				s.borderPalettes[p][c] = uint16(data[i]) | uint16(data[i+1])<<8
+			}
+		}
+	}
+	s.transfer = 0
+}
+
+// toARGB converts a 15 bit color (Bit 0-4 red, 5-9 green, 10-14 blue) to 0xAARRGGBB.
+func toARGB(rgb uint16) uint32 {
+	r := uint32(rgb & 0x1F)
+	g := uint32(rgb >> 5 & 0x1F)
+	b := uint32(rgb >> 10 & 0x1F)
+	return 0xFF000000 | (r<<3|r>>2)<<16 | (g<<3|g>>2)<<8 | (b<<3 | b>>2)
+}
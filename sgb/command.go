@@ -0,0 +1,128 @@
+package sgb
+
+// PAL01, PAL23, PAL03 and PAL12
+//
+//	Byte  Content
+//	0     Command*8+Length (fixed length=01h)
+//	1-E   Color 0 for all palettes, colors 1-3 of palette a, colors 1-3 of palette b
+//	F     Not used (00h)
+func (s *SGB) setPalettes(a, b int, data []uint8) {
+	color := func(i int) uint16 {
+		return (uint16(data[1+i*2]) | uint16(data[2+i*2])<<8) & 0x7FFF
+	}
+
+	for p := range s.palettes {
+		s.palettes[p][0] = color(0)
+	}
+	for i := 1; i < 4; i++ {
+		s.palettes[a][i] = color(i)
+		s.palettes[b][i] = color(i + 3)
+	}
+}
+
+// ATTR_BLK
+//
+//	Byte  Content
+//	1     Number of Data Sets (01h..12h)
+//	2-7   Data Set #1
+//	        Byte 0 - Control Code (0-7)
+//	          Bit 0 - Change Colors inside of surrounded area     (1=Yes)
+//	          Bit 1 - Change Colors of surrounding character line (1=Yes)
+//	          Bit 2 - Change Colors outside of surrounded area    (1=Yes)
+//	        Byte 1 - Color Palette Designation
+//	          Bit 0-1 - Palette Number for inside of surrounded area
+//	          Bit 2-3 - Palette Number for surrounding character line
+//	          Bit 4-5 - Palette Number for outside of surrounded area
+//	        Byte 2 - Coordinate X1 (left)
+//	        Byte 3 - Coordinate Y1 (upper)
+//	        Byte 4 - Coordinate X2 (right)
+//	        Byte 5 - Coordinate Y2 (lower)
+//	8-D   Data Set #2
+//	...
+func (s *SGB) attrBlock(data []uint8) {
+	sets := int(data[1] & 0x1F)
+	for i := 0; i < sets && 2+i*6+5 < len(data); i++ {
+		set := data[2+i*6:]
+		control := set[0] & 0x07
+		inside := set[1] & 0x03
+		line := set[1] >> 2 & 0x03
+		outside := set[1] >> 4 & 0x03
+		x1, y1, x2, y2 := int(set[2]), int(set[3]), int(set[4]), int(set[5])
+
+		// Changing only the inside or the outside changes the line as well.
+		switch control {
+		case 0x01:
+			control, line = 0x03, inside
+		case 0x04:
+			control, line = 0x06, outside
+		}
+
+		for x := 0; x < BLOCKS_X; x++ {
+			for y := 0; y < BLOCKS_Y; y++ {
+				switch {
+				case x1 < x && x < x2 && y1 < y && y < y2:
+					if control&0x01 != 0 {
+						s.attrs[x][y] = inside
+					}
+				case x < x1 || x2 < x || y < y1 || y2 < y:
+					if control&0x04 != 0 {
+						s.attrs[x][y] = outside
+					}
+				default:
+					if control&0x02 != 0 {
+						s.attrs[x][y] = line
+					}
+				}
+			}
+		}
+	}
+}
+
+// ATTR_LIN
+//
+//	Byte  Content
+//	1     Number of Data Sets (01h..6Eh) (one byte each)
+//	2     Data Set #1
+//	        Bit 0-4 - Line Number (X- or Y-coordinate, depending on bit 7)
+//	        Bit 5-6 - Palette Number (0-3)
+//	        Bit 7   - H/V Mode Bit (0=Vertical line, 1=Horizontal Line)
+//	3     Data Set #2
+//	...
+func (s *SGB) attrLine(data []uint8) {
+	sets := int(data[1])
+	for i := 0; i < sets && 2+i < len(data); i++ {
+		set := data[2+i]
+		n := int(set & 0x1F)
+		palette := set >> 5 & 0x03
+
+		if set&0x80 != 0 {
+			for x := 0; x < BLOCKS_X && n < BLOCKS_Y; x++ {
+				s.attrs[x][n] = palette
+			}
+		} else {
+			for y := 0; y < BLOCKS_Y && n < BLOCKS_X; y++ {
+				s.attrs[n][y] = palette
+			}
+		}
+	}
+}
+
+// MLT_REQ
+//
+//	Byte 1 - Multiplayer Control (0-3)
+//	  Bit 0 - Joypad Enable
+//	  Bit 1 - Number of joypads (0=2 joypads, 1=4 joypads)
+//
+// The games check if the SGB is there by reading
+// a different joypad ID after requesting 2 players.
+func (s *SGB) multiplayer(control uint8) {
+	switch control & 0x03 {
+	case 0x01:
+		s.players = 2
+	case 0x03:
+		s.players = 4
+	default:
+		s.players = 1
+	}
+	s.joypad.Player = 0
+}
@@ -0,0 +1,181 @@
+package sgb
+
+import (
+	"log"
+	"tgb/joypad"
+	"tgb/memory"
+)
+
+// Command codes, the upper 5 bits of the first byte of a packet.
+const (
+	PAL01    = 0x00 // Set SGB Palette 0,1 Data
+	PAL23    = 0x01 // Set SGB Palette 2,3 Data
+	PAL03    = 0x02 // Set SGB Palette 0,3 Data
+	PAL12    = 0x03 // Set SGB Palette 1,2 Data
+	ATTR_BLK = 0x04 // "Block" Area Designation Mode
+	ATTR_LIN = 0x05 // "Line" Area Designation Mode
+	MLT_REQ  = 0x11 // Controller 2 Request
+	CHR_TRN  = 0x13 // Transfer Character Font Data
+	PCT_TRN  = 0x14 // Set Screen Data Color Data
+	MASK_EN  = 0x17 // Game Boy Window Mask
+
+	PACKET_SIZE = 16
+
+	// The GB screen is colorized in blocks of 8x8 pixels.
+	BLOCKS_X = 20
+	BLOCKS_Y = 18
+)
+
+// MASK_EN
+const (
+	MASK_CANCEL = 0 // show the screen
+	MASK_FREEZE = 1 // keep showing the last picture
+	MASK_BLACK  = 2
+	MASK_COLOR0 = 3 // fill with color 0
+)
+
+// SGB receives the command packets the game sends through P1
+// and keeps what the SNES side would show around the GB screen.
+//
+// A packet starts with P14 and P15 both low (reset pulse), followed by
+// 128 bits, LSB first. A 0 is P14 low, a 1 is P15 low, and both go
+// high between the bits. A 0 bit ends the packet.
+type SGB struct {
+	joypad *joypad.Joypad
+	// VRAM, for CHR_TRN and PCT_TRN
+	mem *memory.Memory
+
+	// P14/P15 last written
+	p1 uint8
+	// receiving a packet, bits is the number of bits received
+	receiving bool
+	bits      int
+	packet    [PACKET_SIZE]uint8
+	// packets of the current command
+	packets []uint8
+
+	// 4 palettes of 4 colors in 15 bit RGB, color 0 is shared.
+	palettes [4][4]uint16
+	// palette of each 8x8 block of the screen
+	attrs [BLOCKS_X][BLOCKS_Y]uint8
+	mask  uint8
+
+	players uint8
+
+	// VRAM transfer waiting for the next frame
+	transfer    uint8
+	transferArg uint8
+
+	// 256 tiles of 4 bit colors (SNES format) for the border
+	borderTiles [256 * 32]uint8
+	// 32x32 BG map, each entry is
+	//  Bit 0-9   Tile number
+	//  Bit 10-12 Palette number (4-7)
+	//  Bit 14    X flip
+	//  Bit 15    Y flip
+	borderMap [32 * 32]uint16
+	// palettes 4-7 of the border, 16 colors each
+	borderPalettes [4][16]uint16
+}
+
+// New connects an SGB to the P1 register of j.
+func New(j *joypad.Joypad, mem *memory.Memory) *SGB {
+	s := &SGB{
+		joypad:  j,
+		mem:     mem,
+		p1:      0x30,
+		players: 1,
+	}
+	for i := range s.palettes {
+		s.palettes[i] = [4]uint16{0x7FFF, 0x56B5, 0x294A, 0x0000}
+	}
+	j.OnWrite = s.writeP1
+	return s
+}
+
+func (s *SGB) writeP1(val uint8) {
+	val &= 0x30
+	prev := s.p1
+	s.p1 = val
+
+	// With more than one player, the next controller is selected
+	// when P15 goes back high.
+	if s.players > 1 && prev&0x20 == 0 && val == 0x30 {
+		s.joypad.Player = (s.joypad.Player + 1) % s.players
+	}
+
+	switch val {
+	case 0x00:
+		s.receiving = true
+		s.bits = 0
+		s.packet = [PACKET_SIZE]uint8{}
+	case 0x10, 0x20:
+		if !s.receiving || prev != 0x30 {
+			return
+		}
+		s.receiveBit(val == 0x10)
+	}
+}
+
+func (s *SGB) receiveBit(one bool) {
+	if s.bits == PACKET_SIZE*8 {
+		// stop bit
+		s.receiving = false
+		if !one {
+			s.receivePacket()
+		}
+		return
+	}
+
+	if one {
+		s.packet[s.bits/8] |= 1 << uint(s.bits%8)
+	}
+	s.bits++
+}
+
+// The first byte of a command is
+//
+//	Bit 7-3  Command Code
+//	Bit 2-0  Length (1-7 packets)
+func (s *SGB) receivePacket() {
+	s.packets = append(s.packets, s.packet[:]...)
+
+	length := int(s.packets[0] & 0x07)
+	if length == 0 {
+		length = 1
+	}
+	if len(s.packets) < length*PACKET_SIZE {
+		return
+	}
+
+	data := s.packets
+	s.packets = nil
+	s.execute(data[0]>>3, data)
+}
+
+func (s *SGB) execute(command uint8, data []uint8) {
+	switch command {
+	case PAL01:
+		s.setPalettes(0, 1, data)
+	case PAL23:
+		s.setPalettes(2, 3, data)
+	case PAL03:
+		s.setPalettes(0, 3, data)
+	case PAL12:
+		s.setPalettes(1, 2, data)
+	case ATTR_BLK:
+		s.attrBlock(data)
+	case ATTR_LIN:
+		s.attrLine(data)
+	case MLT_REQ:
+		s.multiplayer(data[1])
+	case CHR_TRN, PCT_TRN:
+		// The data is taken from the screen of the next frame.
+		s.transfer = command
+		s.transferArg = data[1]
+	case MASK_EN:
+		s.mask = data[1] & 0x03
+	default:
+		log.Printf("sgb: command %02Xh is not supported", command)
+	}
+}
@@ -0,0 +1,62 @@
+package sgb
+
+// State is what a save state keeps of the SGB.
+type State struct {
+	P1        uint8
+	Receiving bool
+	Bits      int64
+	Packet    [PACKET_SIZE]uint8
+	// the first NumPackets of a command of up to 7 packets
+	Packets    [7 * PACKET_SIZE]uint8
+	NumPackets uint8
+
+	Palettes [4][4]uint16
+	Attrs    [BLOCKS_X][BLOCKS_Y]uint8
+	Mask     uint8
+	Players  uint8
+
+	Transfer    uint8
+	TransferArg uint8
+
+	BorderTiles    [256 * 32]uint8
+	BorderMap      [32 * 32]uint16
+	BorderPalettes [4][16]uint16
+}
+
+func (s *SGB) State() *State {
+	st := &State{
+		P1:             s.p1,
+		Receiving:      s.receiving,
+		Bits:           int64(s.bits),
+		Packet:         s.packet,
+		NumPackets:     uint8(len(s.packets) / PACKET_SIZE),
+		Palettes:       s.palettes,
+		Attrs:          s.attrs,
+		Mask:           s.mask,
+		Players:        s.players,
+		Transfer:       s.transfer,
+		TransferArg:    s.transferArg,
+		BorderTiles:    s.borderTiles,
+		BorderMap:      s.borderMap,
+		BorderPalettes: s.borderPalettes,
+	}
+	copy(st.Packets[:], s.packets)
+	return st
+}
+
+func (s *SGB) SetState(st *State) {
+	s.p1 = st.P1
+	s.receiving = st.Receiving
+	s.bits = int(st.Bits)
+	s.packet = st.Packet
+	s.packets = append([]uint8(nil), st.Packets[:int(st.NumPackets)*PACKET_SIZE]...)
+	s.palettes = st.Palettes
+	s.attrs = st.Attrs
+	s.mask = st.Mask
+	s.players = st.Players
+	s.transfer = st.Transfer
+	s.transferArg = st.TransferArg
+	s.borderTiles = st.BorderTiles
+	s.borderMap = st.BorderMap
+	s.borderPalettes = st.BorderPalettes
+}
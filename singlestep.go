@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"tgb/singlestep"
+)
+
+func singleStepCommand(args []string) error {
+	fs := flag.NewFlagSet("singlestep", flag.ExitOnError)
+	prefix := fs.String("run", "", "only run the files starting with this, e.g. \"03\" or \"cb \"")
+	verbose := fs.Bool("v", false, "also list the files that pass")
+	failures := fs.Int("failures", singlestep.DEFAULT_MAX_FAILURES, "failures printed per file")
+	fs.Parse(args)
+
+	dir := "testdata/sm83/v1"
+	switch fs.NArg() {
+	case 0:
+	case 1:
+		dir = fs.Arg(0)
+	default:
+		fs.Usage()
+		return errors.New("singlestep: expected at most one directory")
+	}
+
+	opt := singlestep.Options{Prefix: *prefix, MaxFailures: *failures}
+	results, err := singlestep.RunDir(dir, opt)
+	if err != nil {
+		return err
+	}
+
+	passed := 0
+	for _, r := range results {
+		if r.Failed == 0 {
+			passed++
+			if *verbose {
+				fmt.Printf("ok    %-12s %d passed, %d skipped\n", r.File, r.Passed, r.Skipped)
+			}
+			continue
+		}
+		fmt.Printf("FAIL  %-12s %d passed, %d failed, %d skipped\n", r.File, r.Passed, r.Failed, r.Skipped)
+		for _, f := range r.Failures {
+			fmt.Printf("      %s\n", f.Test)
+			for _, d := range f.Diffs {
+				fmt.Printf("        %s\n", d)
+			}
+		}
+	}
+
+	fmt.Printf("%d of %d files pass\n", passed, len(results))
+	if passed != len(results) {
+		return errors.New("singlestep: some opcodes failed")
+	}
+	return nil
+}
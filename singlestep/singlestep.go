@@ -0,0 +1,307 @@
+// Package singlestep runs the SM83 single step tests of the community
+// (https://github.com/SingleStepTests/sm83) on the CPU. Each JSON file
+// has about 1000 tests of one opcode, e.g. "03.json" or "cb 7c.json":
+// the registers and the RAM before and after one instruction, and the
+// bus activity of every M-cycle.
+//
+// A test sets up the CPU and the memory, runs one Step and compares
+// the registers, IME, the RAM, the number of M-cycles and the reads and
+// writes on the bus.
+//
+// The tests are too big for this repository, clone them to testdata/sm83
+// where "tgb singlestep" looks for them by default. singlestep/testdata
+// only has a few opcodes for go test.
+package singlestep
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"tgb/cpu"
+	"tgb/interrupt"
+	"tgb/memory"
+)
+
+// State is the "initial" or "final" state of a test.
+type State struct {
+	PC  uint16 `json:"pc"`
+	SP  uint16 `json:"sp"`
+	A   uint8  `json:"a"`
+	B   uint8  `json:"b"`
+	C   uint8  `json:"c"`
+	D   uint8  `json:"d"`
+	E   uint8  `json:"e"`
+	F   uint8  `json:"f"`
+	H   uint8  `json:"h"`
+	L   uint8  `json:"l"`
+	IME uint8  `json:"ime"`
+	IE  uint8  `json:"ie"`
+	// [address, value] pairs
+	RAM [][2]uint16 `json:"ram"`
+}
+
+func (s State) registers() cpu.Registers {
+	return cpu.Registers{
+		A: s.A, F: s.F, B: s.B, C: s.C, D: s.D, E: s.E, H: s.H, L: s.L,
+		SP: s.SP, PC: s.PC,
+	}
+}
+
+type Test struct {
+	Name    string `json:"name"`
+	Initial State  `json:"initial"`
+	Final   State  `json:"final"`
+	// One entry per M-cycle, [address, data, "r-m"] or null.
+	Cycles []json.RawMessage `json:"cycles"`
+}
+
+// Access is a read or a write of the CPU on the bus.
+type Access struct {
+	Addr  uint16
+	Data  uint8
+	Write bool
+}
+
+func (a Access) String() string {
+	if a.Write {
+		return fmt.Sprintf("write %02X to %04X", a.Data, a.Addr)
+	}
+	return fmt.Sprintf("read %02X from %04X", a.Data, a.Addr)
+}
+
+// Accesses returns the reads and writes of t.Cycles in order, without
+// the M-cycles where the bus is idle ("---" or null).
+func (t Test) Accesses() ([]Access, error) {
+	var accesses []Access
+	for i, raw := range t.Cycles {
+		var cycle []interface{}
+		if err := json.Unmarshal(raw, &cycle); err != nil {
+			return nil, fmt.Errorf("%s: cycle %d: %v", t.Name, i, err)
+		}
+		if len(cycle) != 3 {
+			continue
+		}
+		addr, _ := cycle[0].(float64)
+		data, _ := cycle[1].(float64)
+		kind, _ := cycle[2].(string)
+		switch {
+		case strings.HasPrefix(kind, "r"):
+			accesses = append(accesses, Access{Addr: uint16(addr), Data: uint8(data)})
+		case strings.HasPrefix(kind, "-w"):
+			accesses = append(accesses, Access{Addr: uint16(addr), Data: uint8(data), Write: true})
+		}
+	}
+	return accesses, nil
+}
+
+// Result is the result of one JSON file.
+type Result struct {
+	File    string
+	Passed  int
+	Failed  int
+	Skipped int
+	// The failures, at most Options.MaxFailures of them.
+	Failures []Failure
+}
+
+type Failure struct {
+	Test  string
+	Diffs []string
+}
+
+type Options struct {
+	// Only the files whose name starts with Prefix are run,
+	// e.g. "cb " for the CB opcodes or "" for all of them.
+	Prefix string
+	// Number of failures kept in a Result
+	MaxFailures int
+}
+
+const DEFAULT_MAX_FAILURES = 3
+
+// LoadFile reads the tests of a JSON file.
+func LoadFile(path string) ([]Test, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tests []Test
+	if err := json.Unmarshal(data, &tests); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return tests, nil
+}
+
+// RunDir runs the JSON files of dir.
+func RunDir(dir string, opt Options) ([]Result, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	var results []Result
+	for _, path := range paths {
+		if !strings.HasPrefix(filepath.Base(path), opt.Prefix) {
+			continue
+		}
+		r, err := RunFile(path, opt)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("no test files %s*.json in %s", opt.Prefix, dir)
+	}
+	return results, nil
+}
+
+// RunFile runs the tests of a JSON file, opt.Prefix isn't used.
+func RunFile(path string, opt Options) (Result, error) {
+	tests, err := LoadFile(path)
+	if err != nil {
+		return Result{}, err
+	}
+
+	// One memory for all the tests, run clears what each test touched.
+	mem := memory.New()
+	irq := interrupt.New(mem)
+	r := Result{File: filepath.Base(path)}
+	for _, t := range tests {
+		diffs, ok := run(t, mem, irq)
+		switch {
+		case !ok:
+			r.Skipped++
+		case len(diffs) == 0:
+			r.Passed++
+		default:
+			r.Failed++
+			if len(r.Failures) < opt.MaxFailures {
+				r.Failures = append(r.Failures, Failure{Test: t.Name, Diffs: diffs})
+			}
+		}
+	}
+	return r, nil
+}
+
+// Run runs one test and returns how the final state differs.
+// ok is false if the test can't run on this memory, i.e. it uses
+// FEA0-FEFF where the writes are ignored.
+func Run(t Test) (diffs []string, ok bool) {
+	mem := memory.New()
+	return run(t, mem, interrupt.New(mem))
+}
+
+func run(t Test, mem *memory.Memory, irq *interrupt.Interrupt) (diffs []string, ok bool) {
+	for _, s := range []State{t.Initial, t.Final} {
+		for _, m := range s.RAM {
+			if 0xFEA0 <= m[0] && m[0] <= 0xFEFF {
+				return nil, false
+			}
+		}
+	}
+
+	// Everything the test and the CPU touch is cleared afterwards,
+	// clearing the whole memory for every test would be too slow.
+	written := map[uint16]bool{}
+	var bus []Access
+	defer func() {
+		for _, s := range []State{t.Initial, t.Final} {
+			for _, m := range s.RAM {
+				mem.Data[m[0]] = 0
+			}
+		}
+		for addr := range written {
+			mem.Data[addr] = 0
+		}
+		mem.Data[interrupt.IE] = 0
+	}()
+
+	mem.Data[interrupt.IE] = t.Initial.IE
+	for _, m := range t.Initial.RAM {
+		mem.Data[m[0]] = uint8(m[1])
+	}
+	irq.IME = t.Initial.IME != 0
+
+	c := cpu.NewCPU(mem, irq)
+	c.Set(t.Initial.registers())
+	c.Watch = func(addr uint16, val uint8, write bool) {
+		if write {
+			written[addr] = true
+		}
+		bus = append(bus, Access{Addr: addr, Data: val, Write: write})
+	}
+
+	cycles, err := step(c)
+	if err != nil {
+		return []string{err.Error()}, true
+	}
+	return compare(t, c, mem, irq, cycles, written, bus), true
+}
+
+// step runs one instruction, the unimplemented ones may panic.
+func step(c *cpu.CPU) (cycles int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return c.Step(), nil
+}
+
+func compare(t Test, c *cpu.CPU, mem *memory.Memory, irq *interrupt.Interrupt, cycles int, written map[uint16]bool, bus []Access) []string {
+	var diffs []string
+	want, got := t.Final.registers(), c.Get()
+	if want != got {
+		diffs = append(diffs, fmt.Sprintf("registers: want %s F=%02X, got %s F=%02X", want, want.F, got, got.F))
+	}
+	if ime := irq.IME; ime != (t.Final.IME != 0) {
+		diffs = append(diffs, fmt.Sprintf("IME: want %d, got %t", t.Final.IME, ime))
+	}
+
+	inFinal := map[uint16]bool{}
+	for _, m := range t.Final.RAM {
+		inFinal[m[0]] = true
+		if v := mem.Data[m[0]]; v != uint8(m[1]) {
+			diffs = append(diffs, fmt.Sprintf("[%04X]: want %02X, got %02X", m[0], m[1], v))
+		}
+	}
+	var stray []uint16
+	for addr := range written {
+		if !inFinal[addr] {
+			stray = append(stray, addr)
+		}
+	}
+	sort.Slice(stray, func(i, j int) bool { return stray[i] < stray[j] })
+	for _, addr := range stray {
+		diffs = append(diffs, fmt.Sprintf("[%04X]: unexpected write of %02X", addr, mem.Data[addr]))
+	}
+
+	if cycles != len(t.Cycles) {
+		diffs = append(diffs, fmt.Sprintf("cycles: want %d, got %d", len(t.Cycles), cycles))
+	}
+	return append(diffs, compareBus(t, bus)...)
+}
+
+// compareBus reports the first access that differs from the test.
+func compareBus(t Test, got []Access) []string {
+	want, err := t.Accesses()
+	if err != nil {
+		return []string{err.Error()}
+	}
+	for i := 0; i < len(want) || i < len(got); i++ {
+		switch {
+		case i >= len(got):
+			return []string{fmt.Sprintf("bus access %d: want %s, got none", i+1, want[i])}
+		case i >= len(want):
+			return []string{fmt.Sprintf("bus access %d: want none, got %s", i+1, got[i])}
+		case want[i] != got[i]:
+			return []string{fmt.Sprintf("bus access %d: want %s, got %s", i+1, want[i], got[i])}
+		}
+	}
+	return nil
+}
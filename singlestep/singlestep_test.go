@@ -0,0 +1,55 @@
+package singlestep
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// A few opcodes checked in to run without the clone, written in the
+// format of the upstream files by a reference model of those opcodes.
+const vectorDir = "testdata"
+
+// The same clone as for "tgb singlestep", which runs from the top of the repository.
+const testDir = "../testdata/sm83/v1"
+
+func TestSingleStep(t *testing.T) {
+	runFiles(t, vectorDir)
+}
+
+// TestSingleStepAll runs every opcode of the clone, if there is one.
+func TestSingleStepAll(t *testing.T) {
+	if paths, _ := filepath.Glob(filepath.Join(testDir, "*.json")); len(paths) == 0 {
+		t.Skipf("no test vectors in %s", testDir)
+	}
+	runFiles(t, testDir)
+}
+
+func runFiles(t *testing.T, dir string) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatalf("no test vectors in %s", dir)
+	}
+
+	for _, path := range paths {
+		path := path
+		t.Run(strings.TrimSuffix(filepath.Base(path), ".json"), func(t *testing.T) {
+			r, err := RunFile(path, Options{MaxFailures: DEFAULT_MAX_FAILURES})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, f := range r.Failures {
+				t.Errorf("%s\n\t%s", f.Test, strings.Join(f.Diffs, "\n\t"))
+			}
+			if more := r.Failed - len(r.Failures); more > 0 {
+				t.Errorf("and %d more of %d tests failed", more, r.Passed+r.Failed)
+			}
+			if r.Passed == 0 {
+				t.Error("no test was run")
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package timer
+
+// State is what a save state keeps of the timer.
+type State struct {
+	Cycle           int64
+	InternalCounter int64
+}
+
+func (t *Timer) State() State {
+	return State{Cycle: int64(t.Cycle), InternalCounter: int64(t.InternalCounter)}
+}
+
+func (t *Timer) SetState(s State) {
+	t.Cycle = int(s.Cycle)
+	t.InternalCounter = int(s.InternalCounter)
+}
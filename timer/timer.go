@@ -11,6 +11,9 @@ type Timer struct {
 	// 16bit counter
 	// Upper 8bit of this counter is exactly DIV timer.
 	InternalCounter int
+
+	mem *memory.Memory
+	irq *interrupt.Interrupt
 }
 
 const (
@@ -56,70 +59,95 @@ const (
 // TAC = 00のとき、タイマー割り込みは1秒間に4096回起こる。
 // つまりTIMAは一秒間に4096 * 256 = 1048576回インクリメントが起こった
 
-func New() *Timer {
-	return &Timer{
+func New(mem *memory.Memory, irq *interrupt.Interrupt) *Timer {
+	t := &Timer{
 		Cycle: 0,
 		InternalCounter: 0,
+		mem: mem,
+		irq: irq,
 	}
+	mem.HandleRead(DIV, t.readDIV)
+	mem.HandleWrite(DIV, func(uint8) { t.InternalCounter = 0 })
+	return t
 }
 
+// cycles are counted at the CPU clock, so in CGB double speed
+// DIV and TIMA are incremented twice as fast.
 func (t *Timer) UpdateTimers(cycles int) {
 
 	t.Cycle += cycles
-	if t.Cycle >= 4 {
+	for t.Cycle >= 4 {
 		t.Cycle -= 4
 
-		t.InternalCounter++
-	}
-
-	if t.isInternalCounterOverflow() {
-		t.InternalCounter -= 65536
+		prev := t.InternalCounter
+		t.InternalCounter += 4
+		if t.isInternalCounterOverflow() {
+			t.InternalCounter -= 65536
+		}
+
+		// TIMA is incremented when the bit of the internal counter
+		// selected by TAC changes from 1 to 0.
+		bit := t.inputClockBit()
+		if t.isEnabled() && prev&bit != 0 && t.InternalCounter&bit == 0 {
+			t.incrementTIMA()
+		}
 	}
+}
 
-	// internalCounterを更新したときに、DIVも更新
-	t.reloadDIV()
-
-	// TIMA の更新
-	write(TIMA, read(TIMA)+1)
-
-	if t.IsTIMAOverflowed() {
+func (t *Timer) incrementTIMA() {
+	tima := t.read(TIMA) + 1
+	t.write(TIMA, tima)
 
+	if tima == 0x00 {
 		t.loadTMA()
 		t.timerInterruptRequest()
 	}
-	
 }
 
-func read(addr uint16) uint8 {
-	return memory.Read(addr)
+func (t *Timer) read(addr uint16) uint8 {
+	return t.mem.Read(addr)
 }
 
-func write(addr uint16, val uint8) {
-	memory.Write(addr, val)
+func (t *Timer) write(addr uint16, val uint8) {
+	t.mem.Write(addr, val)
 }
 
 func DividerRegister(cycles int) {
 
 }
 
-func (t *Timer) IsTIMAOverflowed() bool {
-	return false
+func (t *Timer) isEnabled() bool {
+	return t.read(TAC)&0x04 != 0
+}
+
+// inputClockBit returns the bit of the internal counter which
+// goes from 1 to 0 at the frequency selected by TAC.
+func (t *Timer) inputClockBit() int {
+	switch t.read(TAC) & 0x03 {
+	case 0x00:
+		return 1 << 9 // 1024 clocks
+	case 0x01:
+		return 1 << 3 // 16 clocks
+	case 0x02:
+		return 1 << 5 // 64 clocks
+	default:
+		return 1 << 7 // 256 clocks
+	}
 }
 
 func (t *Timer) timerInterruptRequest() {
-	interrupt.SetIF_TimerFlag()
+	t.irq.SetIF_TimerFlag()
 }
 
 func (t *Timer) isInternalCounterOverflow() bool {
 	return t.InternalCounter >= 65536
 }
 
-func (t *Timer) reloadDIV() {
-	currentDIVVal := uint8(t.InternalCounter >> 8)
-	write(DIV, currentDIVVal)
+func (t *Timer) readDIV() uint8 {
+	return uint8(t.InternalCounter >> 8)
 }
 
 func (t *Timer) loadTMA() {
-	write(TIMA, read(TMA))
+	t.write(TIMA, t.read(TMA))
 }
 
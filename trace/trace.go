@@ -0,0 +1,175 @@
+// Package trace logs the CPU state before every instruction in the
+// format of Gameboy Doctor and other emulators, e.g.
+//
+//	A:01 F:B0 B:00 C:13 D:00 E:D8 H:01 L:4D SP:FFFE PC:0100 PCMEM:00,C3,13,02
+//
+// so that the execution can be compared line by line with a reference log.
+// With symbols, the name of PC is appended as a comment, like "; Main".
+package trace
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"tgb/cpu"
+	"tgb/disasm"
+	"tgb/memory"
+)
+
+// Entry is one line of a trace.
+type Entry struct {
+	cpu.Registers
+	// Some emulators don't log PCMEM.
+	HasPCMem bool
+	PCMem    [4]uint8
+}
+
+func (e Entry) String() string {
+	s := Line(e.Registers, e.PCMem)
+	if !e.HasPCMem {
+		s = s[:strings.Index(s, " PCMEM:")]
+	}
+	return s
+}
+
+// Line formats the registers and the 4 bytes from PC.
+func Line(r cpu.Registers, pcmem [4]uint8) string {
+	return fmt.Sprintf("A:%02X F:%02X B:%02X C:%02X D:%02X E:%02X H:%02X L:%02X SP:%04X PC:%04X PCMEM:%02X,%02X,%02X,%02X",
+		r.A, r.F, r.B, r.C, r.D, r.E, r.H, r.L, r.SP, r.PC,
+		pcmem[0], pcmem[1], pcmem[2], pcmem[3])
+}
+
+// PCMem reads the 4 bytes from pc without going through the CPU,
+// so that watchpoints don't see them.
+func PCMem(mem *memory.Memory, pc uint16) [4]uint8 {
+	var b [4]uint8
+	for i := range b {
+		b[i] = mem.Read(pc + uint16(i))
+	}
+	return b
+}
+
+// Current returns the entry of c, which is about to execute the instruction at PC.
+func Current(c *cpu.CPU, mem *memory.Memory) Entry {
+	r := c.Get()
+	return Entry{Registers: r, HasPCMem: true, PCMem: PCMem(mem, r.PC)}
+}
+
+// Parse parses a line written by Write or by another emulator in the same format.
+// The fields may come in any order and the hexadecimal digits in any case.
+// A comment after ";" is ignored.
+func Parse(line string) (Entry, error) {
+	var e Entry
+	if i := strings.Index(line, ";"); i >= 0 {
+		line = line[:i]
+	}
+	seen := map[string]bool{}
+	for _, field := range strings.Fields(line) {
+		i := strings.Index(field, ":")
+		if i < 0 {
+			return Entry{}, fmt.Errorf("bad field %q", field)
+		}
+		key, value := strings.ToUpper(field[:i]), field[i+1:]
+
+		if key == "PCMEM" {
+			bytes := strings.Split(value, ",")
+			if len(bytes) != len(e.PCMem) {
+				return Entry{}, fmt.Errorf("PCMEM has %d bytes, expected %d", len(bytes), len(e.PCMem))
+			}
+			for j, b := range bytes {
+				v, err := strconv.ParseUint(b, 16, 8)
+				if err != nil {
+					return Entry{}, fmt.Errorf("bad PCMEM %q", value)
+				}
+				e.PCMem[j] = uint8(v)
+			}
+			e.HasPCMem = true
+			continue
+		}
+
+		bits := 8
+		if key == "SP" || key == "PC" {
+			bits = 16
+		}
+		v, err := strconv.ParseUint(value, 16, bits)
+		if err != nil {
+			return Entry{}, fmt.Errorf("bad %s %q", key, value)
+		}
+		switch key {
+		case "A":
+			e.A = uint8(v)
+		case "F":
+			e.F = uint8(v)
+		case "B":
+			e.B = uint8(v)
+		case "C":
+			e.C = uint8(v)
+		case "D":
+			e.D = uint8(v)
+		case "E":
+			e.E = uint8(v)
+		case "H":
+			e.H = uint8(v)
+		case "L":
+			e.L = uint8(v)
+		case "SP":
+			e.SP = uint16(v)
+		case "PC":
+			e.PC = uint16(v)
+		default:
+			return Entry{}, fmt.Errorf("unknown field %q", key)
+		}
+		seen[key] = true
+	}
+
+	for _, key := range []string{"A", "F", "B", "C", "D", "E", "H", "L", "SP", "PC"} {
+		if !seen[key] {
+			return Entry{}, fmt.Errorf("missing %s", key)
+		}
+	}
+	return e, nil
+}
+
+// Diff lists the fields that differ between want and got,
+// like "F: B0 != 80". PCMEM is only compared if both have it.
+func Diff(want, got Entry) []string {
+	var diffs []string
+	diff8 := func(name string, w, g uint8) {
+		if w != g {
+			diffs = append(diffs, fmt.Sprintf("%s: %02X != %02X", name, w, g))
+		}
+	}
+	diff8("A", want.A, got.A)
+	diff8("F", want.F, got.F)
+	diff8("B", want.B, got.B)
+	diff8("C", want.C, got.C)
+	diff8("D", want.D, got.D)
+	diff8("E", want.E, got.E)
+	diff8("H", want.H, got.H)
+	diff8("L", want.L, got.L)
+	if want.SP != got.SP {
+		diffs = append(diffs, fmt.Sprintf("SP: %04X != %04X", want.SP, got.SP))
+	}
+	if want.PC != got.PC {
+		diffs = append(diffs, fmt.Sprintf("PC: %04X != %04X", want.PC, got.PC))
+	}
+	if want.HasPCMem && got.HasPCMem {
+		for i := range want.PCMem {
+			diff8(fmt.Sprintf("PCMEM[%d]", i), want.PCMem[i], got.PCMem[i])
+		}
+	}
+	return diffs
+}
+
+// Write writes the line of c, which is about to execute the instruction at PC.
+// syms may be nil.
+func Write(w io.Writer, c *cpu.CPU, mem *memory.Memory, syms disasm.Symbols) error {
+	e := Current(c, mem)
+	if name, ok := syms[e.PC]; ok {
+		_, err := fmt.Fprintf(w, "%s ; %s\n", e, name)
+		return err
+	}
+	_, err := fmt.Fprintln(w, e)
+	return err
+}
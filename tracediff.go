@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"tgb/disasm"
+	"tgb/gb"
+	"tgb/model"
+	"tgb/trace"
+)
+
+var errTraceMismatch = errors.New("tracediff: the traces differ")
+
+func traceDiffCommand(args []string) error {
+	fs := flag.NewFlagSet("tracediff", flag.ExitOnError)
+	context := fs.Int("context", 10, "number of instructions printed before the mismatch")
+	modelName := fs.String("model", "auto", "hardware model: auto, dmg0, dmg, mgb, sgb, cgb or agb")
+	bootROM := fs.String("bootrom", "", "boot ROM to run before the cartridge")
+	symPath := fs.String("sym", "", "symbol file, <rom>.sym is loaded if it exists")
+	frames := fs.Int("frames", 0, "stop after this many frames (0: until the reference log ends)")
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("tracediff: expected a ROM and a reference log")
+	}
+
+	m, err := model.Parse(*modelName)
+	if err != nil {
+		return err
+	}
+	syms, _, err := loadSymbols(*symPath, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	d := &traceDiffer{
+		ref:     bufio.NewScanner(f),
+		context: *context,
+		syms:    syms,
+		out:     os.Stdout,
+	}
+	gb, err := gb.New(fs.Arg(0), gb.Config{
+		Headless: true,
+		Frames:   *frames,
+		BootROM:  *bootROM,
+		Model:    m,
+		Trace:    d,
+	})
+	if err != nil {
+		return err
+	}
+	if err := gb.Boot(); err != nil {
+		return err
+	}
+
+	for !gb.Done() && !d.done {
+		gb.Step()
+	}
+
+	switch {
+	case d.err != nil:
+		return d.err
+	case d.mismatch:
+		return errTraceMismatch
+	case !d.done:
+		fmt.Fprintf(d.out, "the emulation ended after %d matching instructions\n", d.line)
+	default:
+		fmt.Fprintf(d.out, "all %d instructions match\n", d.line)
+	}
+	return nil
+}
+
+// traceDiffer receives the trace of the emulator and compares
+// every line with the next line of the reference log.
+type traceDiffer struct {
+	ref     *bufio.Scanner
+	context int
+	syms    disasm.Symbols
+	out     io.Writer
+
+	line    int
+	history []trace.Entry
+
+	done     bool
+	mismatch bool
+	err      error
+}
+
+func (d *traceDiffer) Write(p []byte) (int, error) {
+	if d.done {
+		return len(p), nil
+	}
+	got, err := trace.Parse(string(p))
+	if err != nil {
+		d.done, d.err = true, err
+		return len(p), nil
+	}
+
+	if !d.ref.Scan() {
+		d.done, d.err = true, d.ref.Err()
+		return len(p), nil
+	}
+	d.line++
+	want, err := trace.Parse(d.ref.Text())
+	if err != nil {
+		d.done, d.err = true, fmt.Errorf("tracediff: line %d of the reference log: %v", d.line, err)
+		return len(p), nil
+	}
+
+	if diffs := trace.Diff(want, got); len(diffs) > 0 {
+		d.report(want, got, diffs)
+		d.done, d.mismatch = true, true
+		return len(p), nil
+	}
+
+	d.history = append(d.history, got)
+	if len(d.history) > d.context {
+		d.history = d.history[1:]
+	}
+	return len(p), nil
+}
+
+// report prints the instructions before the mismatch and how the states differ.
+// The instruction before the mismatch is usually the one to blame.
+func (d *traceDiffer) report(want, got trace.Entry, diffs []string) {
+	fmt.Fprintf(d.out, "mismatch at line %d of the reference log\n\n", d.line)
+	for _, e := range d.history {
+		fmt.Fprintf(d.out, "  %s  %s\n", e, d.disassemble(e))
+	}
+	fmt.Fprintf(d.out, "\nwant %s\ngot  %s\n\n", want, got)
+	for _, diff := range diffs {
+		fmt.Fprintf(d.out, "  %s\n", diff)
+	}
+	if n := len(d.history); n > 0 {
+		fmt.Fprintf(d.out, "\nlast executed %s  %s\n", d.syms.Name(d.history[n-1].PC), d.disassemble(d.history[n-1]))
+	}
+}
+
+// disassemble returns the instruction at PC of e.
+func (d *traceDiffer) disassemble(e trace.Entry) string {
+	in := disasm.DecodeBytes(e.PCMem[:], e.PC)
+	return fmt.Sprintf("%-9s %s", in.Hex(), in.Text(d.syms))
+}